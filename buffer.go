@@ -0,0 +1,70 @@
+package catobase
+
+// bufferLine queues a formatted registration, flushing the buffer once it
+// holds Options.WriteBuffer records. The caller holds the write lock.
+func (db *DB) bufferLine(line string) error {
+	db.buffer = append(db.buffer, line)
+	if len(db.buffer) < db.opts.WriteBuffer {
+		return nil
+	}
+	return db.flushBuffer()
+}
+
+// flushBuffer appends the buffered registrations with a single write and
+// fsync. The caller holds the write lock.
+func (db *DB) flushBuffer() error {
+	if len(db.buffer) == 0 {
+		return nil
+	}
+	a, err := db.openAppender()
+	if err != nil {
+		return err
+	}
+	err = a.write(db.buffer...)
+	if err == nil {
+		err = a.sync()
+	}
+	if cerr := a.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	db.buffer = nil
+	return nil
+}
+
+// bufferedRecord returns the newest buffered registration of path, if there
+// is one. The caller holds the write lock.
+func (db *DB) bufferedRecord(path string) (Record, bool) {
+	if len(db.buffer) == 0 {
+		return Record{}, false
+	}
+	sep, err := db.separator()
+	if err != nil {
+		return Record{}, false
+	}
+	key := db.lookupKey(path)
+	for i := len(db.buffer) - 1; i >= 0; i-- {
+		r, err := db.parseLine(db.buffer[i], sep)
+		if err == nil && db.pathKey(db.resolvePath(r.Path)) == key {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// Flush appends the registrations buffered under Options.WriteBuffer and
+// syncs the database to disk. Buffered registrations are not visible to
+// queries, and are lost if the process dies, until they are flushed: the
+// durability window is up to WriteBuffer records, so call Flush, or Close,
+// at points where losing them would matter.
+func (db *DB) Flush() error {
+	return db.withWriteLock(db.flushBuffer)
+}
+
+// Close flushes any buffered registrations. The handle can still be used
+// afterwards.
+func (db *DB) Close() error {
+	return db.Flush()
+}
@@ -0,0 +1,137 @@
+package catobase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteBufferFlush(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, nil, &Options{WriteBuffer: 3})
+
+	var files []string
+	for i := 0; i < 5; i++ {
+		file := filepath.Join(dir, fmt.Sprintf("file%d.txt", i))
+		setupTestFile(t, file, []string{"Books"})
+		files = append(files, file)
+		if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// The first three were flushed when the buffer filled up
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 3 {
+		t.Errorf("expected 3 flushed records, got %d", len(lines))
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != len(files) {
+		t.Errorf("expected all %d records after Flush, got %v", len(files), matches)
+	}
+
+	// Close flushes too
+	file := filepath.Join(dir, "last.txt")
+	setupTestFile(t, file, []string{"Books"})
+	if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, _ := db.IsRegistered(file); !ok {
+		t.Errorf("expected %s to be registered after Close", file)
+	}
+}
+
+func TestWriteBufferIdempotent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, file, []string{"Books"})
+	db := openTestDB(t, nil, &Options{WriteBuffer: 10, Idempotent: true})
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(db.buffer) != 1 {
+		t.Errorf("expected the repeated registration to be skipped, got %d buffered", len(db.buffer))
+	}
+}
+
+func TestWriteBufferClearAndRebuild(t *testing.T) {
+	folder := t.TempDir()
+	file := filepath.Join(folder, "file.txt")
+	setupTestFile(t, file, []string{"Books"})
+	db := openTestDB(t, nil, &Options{WriteBuffer: 10})
+
+	if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.Clear(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, _ := db.IsRegistered(file); ok {
+		t.Errorf("expected Clear to drop the buffered registration")
+	}
+
+	if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.Rebuild(folder, `\.txt$`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("expected only the rebuilt record, got %v", records)
+	}
+}
+
+func benchmarkRegister(b *testing.B, opts *Options) {
+	file := filepath.Join(b.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("Books\n"), 0644); err != nil {
+		b.Fatalf("failed to create file: %v", err)
+	}
+	db, err := Open(filepath.Join(b.TempDir(), ".catodb"), opts)
+	if err != nil {
+		b.Fatalf("failed to open db: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func BenchmarkRegisterFile(b *testing.B) {
+	benchmarkRegister(b, nil)
+}
+
+func BenchmarkRegisterFileBuffered(b *testing.B) {
+	benchmarkRegister(b, &Options{WriteBuffer: 1000})
+}
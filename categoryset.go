@@ -0,0 +1,59 @@
+package catobase
+
+import "sort"
+
+// CategorySet is a set of category names. Slice returns them sorted, so a
+// set always has one canonical, duplicate-free listing.
+type CategorySet map[string]struct{}
+
+// NewCategorySet returns a set holding categories.
+func NewCategorySet(categories ...string) CategorySet {
+	s := make(CategorySet, len(categories))
+	s.Add(categories...)
+	return s
+}
+
+// Add inserts categories into the set.
+func (s CategorySet) Add(categories ...string) {
+	for _, c := range categories {
+		s[c] = struct{}{}
+	}
+}
+
+// Remove deletes categories from the set.
+func (s CategorySet) Remove(categories ...string) {
+	for _, c := range categories {
+		delete(s, c)
+	}
+}
+
+// Has reports whether category is in the set.
+func (s CategorySet) Has(category string) bool {
+	_, ok := s[category]
+	return ok
+}
+
+// HasAll reports whether every one of categories is in the set.
+func (s CategorySet) HasAll(categories []string) bool {
+	for _, c := range categories {
+		if !s.Has(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of categories in the set.
+func (s CategorySet) Len() int {
+	return len(s)
+}
+
+// Slice returns the categories in sorted order.
+func (s CategorySet) Slice() []string {
+	categories := make([]string, 0, len(s))
+	for c := range s {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	return categories
+}
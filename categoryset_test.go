@@ -0,0 +1,59 @@
+package catobase
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCategorySet(t *testing.T) {
+	s := NewCategorySet("Movies", "Books", "Movies")
+	if s.Len() != 2 {
+		t.Errorf("expected 2 categories, got %d", s.Len())
+	}
+
+	s.Add("Music", "Books")
+	if got := strings.Join(s.Slice(), ","); got != "Books,Movies,Music" {
+		t.Errorf("expected Books,Movies,Music, got %s", got)
+	}
+
+	s.Remove("Movies", "Missing")
+	if s.Has("Movies") {
+		t.Errorf("expected Movies to be removed")
+	}
+	if !s.Has("Books") || !s.HasAll([]string{"Books", "Music"}) {
+		t.Errorf("expected Books and Music to be present")
+	}
+	if s.HasAll([]string{"Books", "Movies"}) {
+		t.Errorf("expected HasAll to fail for a removed category")
+	}
+	if len(NewCategorySet().Slice()) != 0 {
+		t.Errorf("expected an empty slice for an empty set")
+	}
+}
+
+func TestRegisterFileNormalizesCategories(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books", "Movies"})
+	db := openTestDB(t, []string{}, nil)
+
+	if _, err := db.RegisterFile(testFile, []string{"Movies", "Books", "Movies"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if got := strings.Join(records[0].Categories, ","); got != "Books,Movies" {
+		t.Errorf("expected stored categories Books,Movies, got %s", got)
+	}
+
+	matches, err := db.Get("file", []string{"Movies", "Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected 1 match, got %v", matches)
+	}
+}
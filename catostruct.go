@@ -7,7 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
@@ -32,11 +32,77 @@ func CreateCategory(categories []string, fileName string) (bool, error) {
     return true, nil
 }
 
+// CreateCategoryWithDescriptions creates a category file like CreateCategory,
+// writing each category as a "name: description" line, sorted by name.
+// Categories with an empty description are written as a plain name.
+func CreateCategoryWithDescriptions(categories map[string]string, fileName string) (bool, error) {
+    names := make([]string, 0, len(categories))
+    for name := range categories {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    lines := make([]string, 0, len(names))
+    for _, name := range names {
+        if description := categories[name]; description != "" {
+            lines = append(lines, name+": "+description)
+        } else {
+            lines = append(lines, name)
+        }
+    }
+    return CreateCategory(lines, fileName)
+}
+
+// ListCategoriesWithDescriptions reads a category file and maps each category
+// name to its description. Lines of the form "name: description" carry one;
+// plain lines map to an empty description. Blank lines are ignored, and an
+// "@include path" line reads the categories of another file in its place.
+func ListCategoriesWithDescriptions(fileName string) (map[string]string, error) {
+    categories := make(map[string]string)
+    err := readCategoryLines(fileName, func(line string) error {
+        name, description := parseCategoryLine(line)
+        if name != "" {
+            categories[name] = description
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return categories, nil
+}
+
+// parseCategoryLine splits a category file line into its name and optional
+// description.
+func parseCategoryLine(line string) (string, string) {
+    i := strings.Index(line, ":")
+    if i < 0 {
+        return strings.TrimSpace(line), ""
+    }
+    return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+}
+
+// readCategories returns the category names listed in a category file,
+// without descriptions or blank lines, and with included files spliced in.
+func readCategories(fileName string) ([]string, error) {
+    var names []string
+    err := readCategoryLines(fileName, func(line string) error {
+        if name, _ := parseCategoryLine(line); name != "" {
+            names = append(names, name)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return names, nil
+}
+
 func checkFileExists(filename string) (*os.File, error) {
 	file, err := os.Open(filename)
 	if err != nil {
         if errors.Is(err, os.ErrNotExist) {
-            return file, errors.New("file does not exist")
+            return file, os.ErrNotExist
         }
         return file, err
     }
@@ -44,10 +110,51 @@ func checkFileExists(filename string) (*os.File, error) {
 }
 
 func DeleteCategory(categoryToRemove string, fileName string) (bool, error) {
+    if _, err := DeleteCategoryRemaining(categoryToRemove, fileName); err != nil {
+        return false, err
+    }
+    return true, nil
+}
+
+// DeleteCategoryRemaining removes categoryToRemove from the category file
+// fileName and returns the categories left in it.
+func DeleteCategoryRemaining(categoryToRemove string, fileName string) ([]string, error) {
+    return DeleteCategoryWithOptions(categoryToRemove, fileName, nil)
+}
+
+// DeleteCategoryOptions loosens how DeleteCategoryWithOptions matches and
+// cleans up. The zero value removes only lines exactly equal to the category
+// and leaves every other line as it is.
+type DeleteCategoryOptions struct {
+    // Clean trims whitespace around every line and drops blank lines. Lines
+    // are then matched on their category name, so "Movies: films" goes too.
+    Clean bool
+
+    // IgnoreCase matches the category regardless of letter case.
+    IgnoreCase bool
+}
+
+// DeleteCategoryWithOptions is DeleteCategoryRemaining with the matching and
+// cleanup controlled by opts; nil means the strict default.
+func DeleteCategoryWithOptions(categoryToRemove string, fileName string, opts *DeleteCategoryOptions) ([]string, error) {
+    var o DeleteCategoryOptions
+    if opts != nil {
+        o = *opts
+    }
+    matches := func(line string) bool {
+        if o.Clean {
+            line, _ = parseCategoryLine(line)
+        }
+        if o.IgnoreCase {
+            return strings.EqualFold(line, categoryToRemove)
+        }
+        return line == categoryToRemove
+    }
+
     // Open the file for reading
     file, err := checkFileExists(fileName)
     if err != nil {
-        return false, err
+        return nil, err
     }
     defer file.Close()
 
@@ -56,185 +163,475 @@ func DeleteCategory(categoryToRemove string, fileName string) (bool, error) {
     scanner := bufio.NewScanner(file)
     for scanner.Scan() {
         category := scanner.Text()
-        if category != categoryToRemove {
+        if o.Clean {
+            category = strings.TrimSpace(category)
+            if category == "" {
+                continue
+            }
+        }
+        if !matches(category) {
             categories = append(categories, category)
         }
     }
     if err := scanner.Err(); err != nil {
-        return false, err
+        return nil, err
     }
 
     // Write the categories back to the file (overwrite the file)
     f, err := os.OpenFile(fileName, os.O_TRUNC|os.O_WRONLY, 0644)
     if err != nil {
-        return false, err
+        return nil, err
     }
     defer f.Close()
 
     for _, category := range categories {
         if _, err := f.WriteString(category + "\n"); err != nil {
-            return false, err
+            return nil, err
         }
     }
-    return true, nil
+    return categories, nil
 }
 
-func format(path string, categories []string, separator string) string {
-    if separator == "" {
-        separator = "|"
+// ResetCategories empties the category file fileName while keeping it in place.
+// The truncation is a single operation, so readers never see a partial list.
+func ResetCategories(fileName string) error {
+    if err := os.Truncate(fileName, 0); err != nil {
+        if errors.Is(err, os.ErrNotExist) {
+            return errors.New("file does not exist")
+        }
+        return err
     }
-    cat := ""
-    for index, category := range categories {
-        cat += category
-        if index+1 < len(categories) {
-            cat += ","
+    return nil
+}
+
+// NormalizeCategoryFile cleans up the category file fileName in place:
+// names and descriptions are trimmed, blank lines dropped, repeated names
+// merged, keeping the first non-empty description, and the lines sorted by
+// name. "@include" lines are kept, ahead of the names.
+// Names that could not be stored in a record are rejected and leave the file
+// untouched. The file is replaced atomically. It reports whether anything
+// changed.
+func NormalizeCategoryFile(fileName string) (bool, error) {
+    var original, includes []string
+    descriptions := make(map[string]string)
+    err := ReadFileFunc(fileName, func(line string) error {
+        original = append(original, line)
+        if includePath(line) != "" {
+            includes = append(includes, strings.TrimSpace(line))
+            return nil
         }
+        name, description := parseCategoryLine(line)
+        if name == "" {
+            return nil
+        }
+        if err := validateCategories([]string{name}, defaultSeparator); err != nil {
+            return err
+        }
+        if descriptions[name] == "" {
+            descriptions[name] = description
+        }
+        return nil
+    })
+    if err != nil {
+        return false, err
     }
 
-    t := time.Now()
+    names := make([]string, 0, len(descriptions))
+    for name := range descriptions {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    lines := includes
+    for _, name := range names {
+        line := name
+        if descriptions[name] != "" {
+            line += ": " + descriptions[name]
+        }
+        lines = append(lines, line)
+    }
+    if strings.Join(lines, "\n") == strings.Join(original, "\n") {
+        return false, nil
+    }
+    if err := replaceFile(fileName, lines); err != nil {
+        return false, err
+    }
+    return true, nil
+}
 
-    return fmt.Sprintf("%s%s%s%s%s", path, separator, cat, separator, t.Format(time.RFC3339))
+// replaceFile atomically replaces the contents of fileName with lines by
+// writing them to a temporary file beside it and renaming that over it.
+func replaceFile(fileName string, lines []string) error {
+    tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    w := bufio.NewWriter(tmp)
+    for _, line := range lines {
+        w.WriteString(line + "\n")
+    }
+    err = w.Flush()
+    if err == nil {
+        err = tmp.Chmod(0644)
+    }
+    if cerr := tmp.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), fileName)
+}
+
+func format(path string, categories []string, separator string) string {
+    return formatRecord(Record{Path: path, Categories: categories, Registered: time.Now()}, separator)
 }
 
 func readFile(fileName string) ([]string, error) {
-    file, err := os.Open(fileName)
+    var lines []string
+    err := ReadFileFunc(fileName, func(line string) error {
+        lines = append(lines, line)
+        return nil
+    })
     if err != nil {
         return nil, err
     }
+
+    return lines, nil
+}
+
+// ErrStop can be returned from a ReadFileFunc callback to end the iteration
+// early without an error.
+var ErrStop = errors.New("stop iteration")
+
+// ReadFileFunc calls fn for each line of fileName without loading the whole
+// file. If fn returns ErrStop, reading stops and ReadFileFunc returns nil;
+// any other error stops reading and is returned.
+func ReadFileFunc(fileName string, fn func(line string) error) error {
+    file, err := os.Open(fileName)
+    if err != nil {
+        return err
+    }
     defer file.Close()
 
-    var lines []string
     scanner := bufio.NewScanner(file)
     for scanner.Scan() {
-        lines = append(lines, scanner.Text())
+        if err := fn(scanner.Text()); err != nil {
+            if errors.Is(err, ErrStop) {
+                return nil
+            }
+            return err
+        }
     }
-    if err := scanner.Err(); err != nil {
-        return nil, err
+    return scanner.Err()
+}
+
+
+func registerFile(fileName string, categories []string, copy bool) (bool, error) {
+    db, err := Open(defaultDBPath, nil)
+    if err != nil {
+        return false, err
     }
+    return db.RegisterFile(fileName, categories, copy)
+}
 
-    return lines, nil
+// RegisterFile appends a record tagging fileName with categories, stored sorted
+// and without duplicates. The file lists its own categories, so every category
+// given must appear in it.
+// If copy is true, a copy of the file is written next to it with
+// Options.CopySuffix appended, or mirrored under Options.BackupRoot when that
+// is set.
+// With Options.Idempotent set, registering a file again with the categories
+// of its latest record is a no-op that returns false and no error.
+func (db *DB) RegisterFile(fileName string, categories []string, copy bool) (bool, error) {
+    return db.RegisterFileWithMeta(fileName, categories, nil, copy)
 }
 
+// RegisterFileWithMeta is RegisterFile also attaching meta to the record.
+// Metadata keys must not contain ';' or '=', values must not contain ';',
+// and neither may contain the separator.
+func (db *DB) RegisterFileWithMeta(fileName string, categories []string, meta map[string]string, copy bool) (bool, error) {
+    // The file lists its own categories; refuse to tag it with anything else
+    fileCategories, err := readCategories(fileName)
+    switch {
+    case errors.Is(err, os.ErrNotExist) && db.opts.AllowMissing:
+        // A file that does not exist yet has no categories to check
+    case errors.Is(err, os.ErrNotExist):
+        return false, errors.New("file does not exist")
+    case err != nil:
+        return false, err
+    case !containsAll(db.normalize(fileCategories), db.normalize(categories)):
+        return false, errors.New("some categories do not exist")
+    }
+
+    return db.register(fileName, categories, meta, copy)
+}
+
+// ErrVerifyFailed is returned by RegisterFileVerified when the record read
+// back differs from the one registered.
+var ErrVerifyFailed = errors.New("registered record did not read back")
+
+// RegisterFileVerified is RegisterFile followed by reading the latest record
+// of fileName back from the database and checking that it carries the path
+// and categories that were registered, which catches paths or categories the
+// record format cannot hold. A mismatch is reported as ErrVerifyFailed; the
+// record has been written by then. Buffered registrations are flushed first.
+func (db *DB) RegisterFileVerified(fileName string, categories []string, copy bool) (bool, error) {
+    registered, err := db.RegisterFile(fileName, categories, copy)
+    if err != nil {
+        return registered, err
+    }
+    if db.opts.WriteBuffer > 0 {
+        if err := db.Flush(); err != nil {
+            return registered, err
+        }
+    }
+
+    stored, err := db.storedPathOf(fileName)
+    if err != nil {
+        return registered, err
+    }
+    path := db.resolvePath(stored)
+    records, err := db.GetPaths([]string{path})
+    if err != nil {
+        return registered, err
+    }
+    if len(records) == 0 {
+        return registered, fmt.Errorf("%w: no record for %s", ErrVerifyFailed, path)
+    }
+    got := records[0]
+    want := NewCategorySet(db.normalize(categories)...).Slice()
+    if got.Path != path || strings.Join(got.Categories, ",") != strings.Join(want, ",") {
+        return registered, fmt.Errorf("%w: wrote %s with %v, read %s with %v", ErrVerifyFailed, path, want, got.Path, got.Categories)
+    }
+    return registered, nil
+}
+
+// register appends a record for fileName without checking its categories.
+func (db *DB) register(fileName string, categories []string, meta map[string]string, copy bool) (bool, error) {
+    var registered bool
+    err := db.withWriteLock(func() error {
+        var err error
+        registered, err = db.appendRecord(fileName, categories, meta, copy)
+        return err
+    })
+    return registered, err
+}
+
+// appendRecord does the work of register; the caller holds the write lock.
+func (db *DB) appendRecord(fileName string, categories []string, meta map[string]string, copy bool) (bool, error) {
+    if db.opts.Idempotent {
+        duplicate, err := db.isLatest(fileName, categories)
+        if err != nil {
+            return false, err
+        }
+        if duplicate {
+            db.logger().Debug("skipped duplicate registration", "path", fileName)
+            return false, nil
+        }
+    }
+
+    sep, err := db.separator()
+    if err != nil {
+        return false, err
+    }
+    formatted, err := db.prepareRecord(fileName, categories, meta, copy, sep)
+    if err != nil {
+        return false, err
+    }
+
+    // Append the formatted entry to the database
+    if db.opts.WriteBuffer > 0 {
+        err = db.bufferLine(formatted)
+    } else {
+        err = db.appendLines([]string{formatted})
+    }
+    if err != nil {
+        return false, err
+    }
+    db.logger().Debug("registered file", "path", fileName, "categories", categories, "copy", copy)
+    return true, nil
+}
+
+// prepareRecord checks that fileName can be registered, makes its copy if
+// one is wanted and returns its record formatted with sep.
+func (db *DB) prepareRecord(fileName string, categories []string, meta map[string]string, copy bool, sep string) (string, error) {
+    copy = db.copyFor(categories, copy)
 
-func registerFile(fileName string, categories []string, copy bool) (bool, error) {
     // Check if the file exists
     file, err := checkFileExists(fileName)
     if err != nil {
-        return false, err
+        if !errors.Is(err, os.ErrNotExist) || !db.opts.AllowMissing || copy {
+            return "", err
+        }
+    } else {
+        defer file.Close()
     }
-    defer file.Close()
 
     // Format the registration entry
-    formatted := format(fileName, categories, "")
-
-    // Open the .catodb file with the correct flags for appending data
-    db, err := os.OpenFile(".catodb", os.O_APPEND|os.O_WRONLY, 0644)
+    stored, err := db.storedPathOf(fileName)
     if err != nil {
-        return false, fmt.Errorf("failed to open .catodb for writing: %w", err)
+        return "", err
+    }
+    if err := validatePath(stored, sep); err != nil {
+        return "", err
+    }
+    if err := validateCategories(categories, sep); err != nil {
+        return "", err
+    }
+    // Note where the copy goes, if asked to, before making it
+    var destinationFile string
+    if copy {
+        destinationFile, err = db.copyDestination(fileName)
+        if err != nil {
+            return "", err
+        }
+        if db.opts.RecordCopyPath {
+            withCopy := make(map[string]string, len(meta)+1)
+            for k, v := range meta {
+                withCopy[k] = v
+            }
+            withCopy[copyMetaKey] = destinationFile
+            meta = withCopy
+        }
+    }
+    if err := validateMeta(meta, sep); err != nil {
+        return "", err
     }
-    defer db.Close()
 
     // If copy is true, create a copy of the file
     if copy {
-        destinationFile := fileName + ".copy"
         dst, err := os.Create(destinationFile)
         if err != nil {
-            return false, fmt.Errorf("failed to create copy of file: %w", err)
+            return "", fmt.Errorf("failed to create copy of file: %w", err)
         }
         defer dst.Close()
 
         if _, err := io.Copy(dst, file); err != nil {
-            return false, fmt.Errorf("failed to copy file: %w", err)
+            return "", fmt.Errorf("failed to copy file: %w", err)
         }
     }
 
-    // Write the formatted entry to .catodb
-    _, err = db.WriteString(formatted + "\n")
-    if err != nil {
-        return false, fmt.Errorf("failed to write to .catodb: %w", err)
-    }
+    return formatRecord(Record{
+        Path:       stored,
+        Categories: NewCategorySet(db.normalize(categories)...).Slice(),
+        Registered: time.Now(),
+        Meta:       meta,
+    }, sep), nil
+}
 
-    return true, nil
+// copyFor decides whether a file registered with categories is copied:
+// Options.CopyPolicy if any of the categories has an entry there, and copy,
+// as asked by the caller, otherwise.
+func (db *DB) copyFor(categories []string, copy bool) bool {
+    decided := false
+    for _, c := range db.normalize(categories) {
+        policy, ok := db.copyPolicy[c]
+        if !ok {
+            continue
+        }
+        if policy {
+            return true
+        }
+        decided = true
+    }
+    if decided {
+        return false
+    }
+    return copy
 }
 
-// registerFiles scans the folder and registers all files that match the regex.
-func registerFiles(folder string, regex string) ([]string, error) {
-    var registeredFiles []string
-    re, err := regexp.Compile(regex)
+// copyDestination returns where the copy of fileName is written: next to it
+// with Options.CopySuffix appended, or under Options.BackupRoot at the same
+// path relative to the database directory, creating directories as needed.
+func (db *DB) copyDestination(fileName string) (string, error) {
+    if db.opts.BackupRoot == "" {
+        return fileName + db.opts.CopySuffix, nil
+    }
+
+    abs, err := filepath.Abs(fileName)
     if err != nil {
-        return nil, err
+        return "", err
+    }
+    base, err := filepath.Abs(filepath.Dir(db.path))
+    if err != nil {
+        return "", err
+    }
+    rel, err := filepath.Rel(base, abs)
+    if err != nil {
+        return "", err
+    }
+    if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return "", fmt.Errorf("cannot back up %s: it is outside %s", fileName, base)
     }
 
-    err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+    destination := filepath.Join(db.opts.BackupRoot, rel)
+    if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+        return "", fmt.Errorf("failed to create backup directory: %w", err)
+    }
+    return destination, nil
+}
+
+// RegisterFileFromCategoryFiles registers target with the union of the
+// categories listed in categoryFiles.
+func (db *DB) RegisterFileFromCategoryFiles(target string, categoryFiles []string, copy bool) (bool, error) {
+    categories := NewCategorySet()
+    for _, name := range categoryFiles {
+        lines, err := readCategories(name)
         if err != nil {
-            return err
-        }
-        if !info.IsDir() && re.MatchString(info.Name()) {
-            categories, err := readFile(path)
-            if err != nil {
-                return err
-            }
-            success, err := registerFile(path, categories, true)
-            if err != nil {
-                return err
-            }
-            if success {
-                registeredFiles = append(registeredFiles, path)
+            if errors.Is(err, os.ErrNotExist) {
+                return false, fmt.Errorf("category file %s does not exist", name)
             }
+            return false, err
         }
-        return nil
-    })
-    if err != nil {
-        return nil, err
+        categories.Add(lines...)
     }
 
-    return registeredFiles, nil
+    return db.register(target, categories.Slice(), nil, copy)
 }
 
-// get searches for registered files based on regex and categories.
-func get(regex string, categories []string) ([]string, error) {
-    db, err := checkFileExists(".catodb")
+// registerFiles scans the folder and registers all files that match the regex.
+// Paths matched by a .catoignore file at the folder root are skipped.
+func registerFiles(folder string, regex string) ([]string, error) {
+    db, err := Open(defaultDBPath, nil)
     if err != nil {
         return nil, err
     }
-    defer db.Close()
+    return db.RegisterFiles(folder, regex, nil)
+}
 
-    re, err := regexp.Compile(regex)
+// get searches for registered files based on regex and categories.
+func get(regex string, categories []string) ([]string, error) {
+    db, err := Open(defaultDBPath, nil)
     if err != nil {
         return nil, err
     }
+    return db.Get(regex, categories)
+}
 
-    var matches []string
-    scanner := bufio.NewScanner(db)
-    for scanner.Scan() {
-        line := scanner.Text()
-        parts := strings.Split(line, "|")
-        if len(parts) < 3 {
-            continue
-        }
-        path := parts[0]
-        fileCategories := strings.Split(parts[1], ",")
-        if re.MatchString(path) && containsAll(fileCategories, categories) {
-            matches = append(matches, path)
-        }
-    }
-    if err := scanner.Err(); err != nil {
-        return nil, err
-    }
+// Get returns the paths of registered files whose path matches regex and
+// whose categories, with those implied by Options.Implications, include all
+// of categories. A path registered more than once is returned a single
+// time, at the position of its first matching record.
+func (db *DB) Get(regex string, categories []string) ([]string, error) {
+    categories = db.normalize(categories)
+    return db.matchPaths(regex, func(r Record) bool {
+        return db.expand(r.Categories).HasAll(categories)
+    })
+}
 
-    return matches, nil
+// GetLimit is Get returning at most n paths. The scan stops as soon as n are
+// found, so a small n answers quickly on a large database. An n of zero or
+// less means no limit.
+func (db *DB) GetLimit(regex string, categories []string, n int) ([]string, error) {
+    categories = db.normalize(categories)
+    return db.matchPathsLimit(regex, n, func(r Record) bool {
+        return db.expand(r.Categories).HasAll(categories)
+    })
 }
 
 // containsAll checks if all elements of subset are in set.
 func containsAll(set, subset []string) bool {
-    setMap := make(map[string]struct{}, len(set))
-    for _, s := range set {
-        setMap[s] = struct{}{}
-    }
-    for _, s := range subset {
-        if _, ok := setMap[s]; !ok {
-            return false
-        }
-    }
-    return true
+    return NewCategorySet(set...).HasAll(subset)
 }
@@ -3,7 +3,10 @@ package catobase
 
 import (
 	"bufio"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -50,6 +53,51 @@ func TestCreateCategory(t *testing.T) {
 	}
 }
 
+func TestListCategoriesWithDescriptions(t *testing.T) {
+	fileName := "test_category_descriptions.txt"
+	setupTestFile(t, fileName, []string{"Books: things to read", "Movies", "", "Music:  songs "})
+	defer cleanupTestFile(t, fileName)
+
+	categories, err := ListCategoriesWithDescriptions(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"Books": "things to read", "Movies": "", "Music": "songs"}
+	if len(categories) != len(expected) {
+		t.Errorf("expected %d categories, got %v", len(expected), categories)
+	}
+	for name, description := range expected {
+		if got, ok := categories[name]; !ok || got != description {
+			t.Errorf("expected %s to be described as %q, got %q", name, description, got)
+		}
+	}
+
+	// Described categories can still be used for registration
+	db := openTestDB(t, []string{}, nil)
+	if _, err := db.RegisterFile(fileName, []string{"Books", "Movies"}, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCreateCategoryWithDescriptions(t *testing.T) {
+	fileName := "test_create_category_descriptions.txt"
+	defer cleanupTestFile(t, fileName)
+
+	_, err := CreateCategoryWithDescriptions(map[string]string{"Movies": "", "Books": "things to read"}, fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines, err := readFile(fileName)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if strings.Join(lines, "\n") != "Books: things to read\nMovies" {
+		t.Errorf("unexpected file contents: %q", lines)
+	}
+}
+
 func TestDeleteCategory(t *testing.T) {
 	fileName := "test_delete_category.txt"
 	setupTestFile(t, fileName, []string{"Books", "Movies", "Music"})
@@ -93,6 +141,76 @@ func TestDeleteCategory(t *testing.T) {
 	}
 }
 
+func TestDeleteCategoryRemaining(t *testing.T) {
+	fileName := "test_delete_category_remaining.txt"
+	setupTestFile(t, fileName, []string{"Books", "Movies", "Music"})
+	defer cleanupTestFile(t, fileName)
+
+	remaining, err := DeleteCategoryRemaining("Movies", fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(remaining, ",") != "Books,Music" {
+		t.Errorf("expected remaining categories Books,Music, got %v", remaining)
+	}
+}
+
+func TestDeleteCategoryWithOptions(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "categories.txt")
+	lines := []string{"Books", "", "  movies  ", "Music", "MOVIES: films", "", "Movies"}
+
+	// The strict default leaves blanks and other spellings alone
+	setupTestFile(t, fileName, lines)
+	remaining, err := DeleteCategoryWithOptions("Movies", fileName, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(remaining, ",") != "Books,,  movies  ,Music,MOVIES: films," {
+		t.Errorf("expected only the exact match removed, got %q", remaining)
+	}
+
+	setupTestFile(t, fileName, lines)
+	remaining, err = DeleteCategoryWithOptions("Movies", fileName, &DeleteCategoryOptions{Clean: true, IgnoreCase: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(remaining, ",") != "Books,Music" {
+		t.Errorf("expected Books,Music, got %q", remaining)
+	}
+	written, err := readFile(fileName)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if strings.Join(written, ",") != "Books,Music" {
+		t.Errorf("expected the file to hold Books,Music, got %q", written)
+	}
+}
+
+func TestResetCategories(t *testing.T) {
+	fileName := "test_reset_categories.txt"
+	setupTestFile(t, fileName, []string{"Books", "Movies"})
+	defer cleanupTestFile(t, fileName)
+
+	if err := ResetCategories(fileName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatalf("expected file to still exist: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected empty file, got %d bytes", info.Size())
+	}
+
+	// Test resetting a file that does not exist
+	err = ResetCategories("test_reset_missing.txt")
+	if err == nil || err.Error() != "file does not exist" {
+		t.Errorf("expected error 'file does not exist', got %v", err)
+	}
+}
+
 func TestFormat(t *testing.T) {
 	// Test with default separator
 	result := format("/path/to/file", []string{"Books", "Movies"}, "")
@@ -195,6 +313,28 @@ func TestReadFile(t *testing.T) {
 	}
 }
 
+func TestReadFileFuncStopsEarly(t *testing.T) {
+	fileName := "test_read_file_func.txt"
+	setupTestFile(t, fileName, []string{"Books", "Movies", "Music"})
+	defer cleanupTestFile(t, fileName)
+
+	var seen []string
+	err := ReadFileFunc(fileName, func(line string) error {
+		seen = append(seen, line)
+		if line == "Movies" {
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(seen, ",") != "Books,Movies" {
+		t.Errorf("expected iteration to stop after Movies, got %v", seen)
+	}
+}
+
 func TestRegisterFiles(t *testing.T) {
 	folder := "test_folder"
 	os.Mkdir(folder, 0755)
@@ -244,3 +384,380 @@ func TestGet(t *testing.T) {
 		t.Errorf("expected match to be /path/to/file1, got %s", matches[0])
 	}
 }
+
+func TestRegisterFileFromCategoryFiles(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	setupTestFile(t, target, []string{"content"})
+	setupTestFile(t, first, []string{"Books", "Movies"})
+	setupTestFile(t, second, []string{"Movies", "Music"})
+	db := openTestDB(t, []string{}, nil)
+
+	success, err := db.RegisterFileFromCategoryFiles(target, []string{first, second}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !success {
+		t.Errorf("expected success, got failure")
+	}
+
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	got := strings.Join(records[0].Categories, ",")
+	if got != "Books,Movies,Music" {
+		t.Errorf("expected categories Books,Movies,Music, got %s", got)
+	}
+
+	// Test with a missing category file
+	_, err = db.RegisterFileFromCategoryFiles(target, []string{first, filepath.Join(dir, "missing.txt")}, false)
+	if err == nil || !strings.Contains(err.Error(), "missing.txt does not exist") {
+		t.Errorf("expected error naming the missing category file, got %v", err)
+	}
+}
+
+func TestRegisterFileCreatesDB(t *testing.T) {
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, nil, nil)
+
+	success, err := db.RegisterFile(testFile, []string{"Books"}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !success {
+		t.Errorf("expected success, got failure")
+	}
+
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("expected db to be created: %v", err)
+	}
+	if len(lines) != 1 {
+		t.Errorf("expected 1 record, got %d", len(lines))
+	}
+}
+
+func TestGetDeduplicatesPaths(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books|2023-07-01T00:00:00Z",
+		"/path/to/file1|Books,Movies|2023-07-02T00:00:00Z",
+	}, nil)
+
+	matches, err := db.Get("file", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"/path/to/file1", "/path/to/file2"}
+	if strings.Join(matches, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected matches %v, got %v", expected, matches)
+	}
+}
+
+func TestGetStrict(t *testing.T) {
+	lines := []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"garbage",
+		"/path/to/file2|Books|2023-07-01T00:00:00Z",
+	}
+
+	// Lenient mode skips the bad line
+	db := openTestDB(t, lines, nil)
+	matches, err := db.Get("file", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Errorf("expected 2 matches, got %d", len(matches))
+	}
+
+	// Strict mode reports it
+	db = openTestDB(t, lines, &Options{Strict: true})
+	_, err = db.Get("file", []string{"Books"})
+	if err == nil {
+		t.Fatalf("expected error for malformed line")
+	}
+	if !strings.Contains(err.Error(), ":2:") || !strings.Contains(err.Error(), `"garbage"`) {
+		t.Errorf("expected error to name line 2 and its content, got %v", err)
+	}
+}
+
+func TestRegisterFileRejectsSeparator(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file|1.txt")
+	setupTestFile(t, testFile, []string{"Books", "Bad|Category"})
+	db := openTestDB(t, []string{}, nil)
+
+	_, err := db.RegisterFile(testFile, []string{"Books"}, false)
+	if err == nil || !strings.Contains(err.Error(), "path") {
+		t.Errorf("expected error naming the path, got %v", err)
+	}
+
+	otherFile := filepath.Join(t.TempDir(), "file2.txt")
+	setupTestFile(t, otherFile, []string{"Bad|Category"})
+	_, err = db.RegisterFile(otherFile, []string{"Bad|Category"}, false)
+	if err == nil || !strings.Contains(err.Error(), `category "Bad|Category"`) {
+		t.Errorf("expected error naming the category, got %v", err)
+	}
+
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("expected nothing to be written, got %v", lines)
+	}
+}
+
+func TestRegisterFileBackupRoot(t *testing.T) {
+	data := t.TempDir()
+	backup := t.TempDir()
+	testFile := filepath.Join(data, "a", "b.txt")
+	os.MkdirAll(filepath.Dir(testFile), 0755)
+	setupTestFile(t, testFile, []string{"Books"})
+
+	db, err := Open(filepath.Join(data, ".catodb"), &Options{BackupRoot: backup})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines, err := readFile(filepath.Join(backup, "a", "b.txt"))
+	if err != nil {
+		t.Fatalf("expected mirrored copy: %v", err)
+	}
+	if strings.Join(lines, ",") != "Books" {
+		t.Errorf("unexpected copy contents: %v", lines)
+	}
+	if _, err := os.Stat(testFile + ".copy"); !os.IsNotExist(err) {
+		t.Errorf("expected no .copy file next to the original")
+	}
+
+	// Files outside the database directory are refused
+	outside := filepath.Join(t.TempDir(), "c.txt")
+	setupTestFile(t, outside, []string{"Books"})
+	if _, err := db.RegisterFile(outside, []string{"Books"}, true); err == nil {
+		t.Errorf("expected error for a file outside the database directory")
+	}
+}
+
+func TestRegisterFileCopySuffix(t *testing.T) {
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "a.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+
+	db, err := Open(filepath.Join(dir, ".catodb"), &Options{CopySuffix: ".bak"})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(testFile + ".bak"); err != nil {
+		t.Errorf("expected a .bak copy: %v", err)
+	}
+	if _, err := os.Stat(testFile + ".copy"); !os.IsNotExist(err) {
+		t.Errorf("expected no .copy file")
+	}
+
+	// A walk skips the copy it made before
+	files, err := db.RegisterFiles(dir, `\.txt`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 1 || files[0] != testFile {
+		t.Errorf("expected only %s to be registered, got %v", testFile, files)
+	}
+}
+
+func TestRegisterFileCopyPolicy(t *testing.T) {
+	dir := t.TempDir()
+	archived := filepath.Join(dir, "archived.txt")
+	plain := filepath.Join(dir, "plain.txt")
+	scratch := filepath.Join(dir, "scratch.txt")
+	both := filepath.Join(dir, "both.txt")
+	setupTestFile(t, archived, []string{"Archive", "Books"})
+	setupTestFile(t, plain, []string{"Books"})
+	setupTestFile(t, scratch, []string{"Scratch"})
+	setupTestFile(t, both, []string{"Archive", "Scratch"})
+
+	db := openTestDB(t, nil, &Options{CopyPolicy: map[string]bool{"Archive": true, "Scratch": false}})
+	for _, tc := range []struct {
+		file       string
+		categories []string
+		copy       bool
+		copied     bool
+	}{
+		{archived, []string{"Archive", "Books"}, false, true},
+		{plain, []string{"Books"}, false, false},
+		{scratch, []string{"Scratch"}, true, false},
+		{both, []string{"Archive", "Scratch"}, false, true},
+	} {
+		if _, err := db.RegisterFile(tc.file, tc.categories, tc.copy); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err := os.Stat(tc.file + ".copy")
+		if copied := err == nil; copied != tc.copied {
+			t.Errorf("%s: expected copied to be %v, got %v", filepath.Base(tc.file), tc.copied, copied)
+		}
+	}
+}
+
+func TestRegisterFileIdempotent(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books", "Movies"})
+	db := openTestDB(t, nil, &Options{Idempotent: true})
+
+	for i, expected := range []bool{true, false} {
+		registered, err := db.RegisterFile(testFile, []string{"Movies", "Books"}, false)
+		if err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i+1, err)
+		}
+		if registered != expected {
+			t.Errorf("attempt %d: expected registered to be %v, got %v", i+1, expected, registered)
+		}
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 1 {
+		t.Errorf("expected a single record, got %v", lines)
+	}
+
+	// Different categories are a new registration
+	if registered, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil || !registered {
+		t.Errorf("expected a new record for different categories, got %v, %v", registered, err)
+	}
+}
+
+func TestNormalizeCategoryFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "categories.txt")
+	setupTestFile(t, fileName, []string{
+		"  Music ",
+		"",
+		"Books: Printed works",
+		"   ",
+		"Movies",
+		"Books",
+		"Music:   Songs  ",
+	})
+
+	changed, err := NormalizeCategoryFile(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected the file to change")
+	}
+	lines, err := readFile(fileName)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	expected := []string{"Books: Printed works", "Movies", "Music: Songs"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+
+	// A clean file is left alone
+	changed, err = NormalizeCategoryFile(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed {
+		t.Errorf("expected a normalized file not to change")
+	}
+
+	// Invalid names are rejected
+	bad := filepath.Join(t.TempDir(), "bad.txt")
+	setupTestFile(t, bad, []string{"Books", "Sci,Fi"})
+	if _, err := NormalizeCategoryFile(bad); err == nil {
+		t.Errorf("expected error for a name containing a comma")
+	}
+	if lines, _ := readFile(bad); len(lines) != 2 {
+		t.Errorf("expected the invalid file to be untouched, got %v", lines)
+	}
+}
+
+func TestRegisterFileRecordCopyPath(t *testing.T) {
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "a.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db, err := Open(filepath.Join(dir, ".catodb"), &Options{RecordCopyPath: true})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+
+	for _, copy := range []bool{true, false} {
+		if _, err := db.RegisterFile(testFile, []string{"Books"}, copy); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		records, err := db.GetPaths([]string{testFile})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := ""
+		if copy {
+			expected = testFile + ".copy"
+		}
+		if got := records[0].CopyPath(); got != expected {
+			t.Errorf("copy=%v: expected copy path %q, got %q", copy, expected, got)
+		}
+	}
+}
+
+func TestRegisterFileAllowMissing(t *testing.T) {
+	planned := filepath.Join(t.TempDir(), "planned.txt")
+
+	db := openTestDB(t, nil, nil)
+	if _, err := db.RegisterFile(planned, []string{"Books"}, false); err == nil {
+		t.Errorf("expected error for a missing file by default")
+	}
+
+	db = openTestDB(t, nil, &Options{AllowMissing: true})
+	registered, err := db.RegisterFile(planned, []string{"Books"}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !registered {
+		t.Errorf("expected the planned file to be registered")
+	}
+	if ok, _ := db.IsRegistered(planned); !ok {
+		t.Errorf("expected a record for %s", planned)
+	}
+	if _, err := db.RegisterFile(planned, []string{"Books"}, true); err == nil {
+		t.Errorf("expected error copying a missing file")
+	}
+}
+
+func TestRegisterFileVerified(t *testing.T) {
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "notes #1; a=b, café [draft].txt")
+	setupTestFile(t, testFile, []string{"Books", "Über-Kategorie"})
+
+	for _, opts := range []*Options{nil, {WriteBuffer: 10}} {
+		db := openTestDB(t, nil, opts)
+		registered, err := db.RegisterFileVerified(testFile, []string{"Über-Kategorie", "Books"}, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !registered {
+			t.Errorf("expected %s to be registered", testFile)
+		}
+	}
+
+	db := openTestDB(t, nil, nil)
+	if _, err := db.RegisterFileVerified(filepath.Join(dir, "missing.txt"), []string{"Books"}, false); err == nil || errors.Is(err, ErrVerifyFailed) {
+		t.Errorf("expected the registration error for a missing file, got %v", err)
+	}
+}
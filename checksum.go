@@ -0,0 +1,56 @@
+package catobase
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+// checksumPrefix starts the footer line holding the checksum of the
+// database, see Options.Checksum.
+const checksumPrefix = "#sum="
+
+// ErrNoChecksum is returned by VerifyChecksum for a database whose last line
+// is not a checksum footer.
+var ErrNoChecksum = errors.New("database has no checksum footer")
+
+// isChecksumLine reports whether line is a checksum footer.
+func isChecksumLine(line string) bool {
+	return strings.HasPrefix(line, checksumPrefix)
+}
+
+// checksumLine returns the footer holding sum, the SHA-256 of the contents
+// before it.
+func checksumLine(sum []byte) string {
+	return checksumPrefix + hex.EncodeToString(sum)
+}
+
+// VerifyChecksum recomputes the SHA-256 of the database contents before the
+// checksum footer written under Options.Checksum and reports whether it
+// still matches. A compressed database is checked after decompression.
+// Staged appends are not covered until they are merged. A database with
+// no footer as its last line, which includes one appended to in place
+// while Checksum was off, yields ErrNoChecksum.
+func (db *DB) VerifyChecksum() (bool, error) {
+	file, err := db.openMain()
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return false, err
+	}
+
+	body := bytes.TrimSuffix(data, []byte("\n"))
+	start := bytes.LastIndexByte(body, '\n') + 1
+	footer := string(body[start:])
+	if !isChecksumLine(footer) {
+		return false, ErrNoChecksum
+	}
+	sum := sha256.Sum256(data[:start])
+	return footer == checksumLine(sum[:]), nil
+}
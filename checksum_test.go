@@ -0,0 +1,64 @@
+package catobase
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}, &Options{Checksum: true})
+
+	if _, err := db.VerifyChecksum(); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("expected ErrNoChecksum before the first rewrite, got %v", err)
+	}
+	if err := db.Canonicalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, err := db.VerifyChecksum(); err != nil || !ok {
+		t.Fatalf("expected the checksum to verify, got %v, %v", ok, err)
+	}
+
+	// Appends keep the footer up to date and it is never read as a record
+	testFile := filepath.Join(t.TempDir(), "file3.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, err := db.VerifyChecksum(); err != nil || !ok {
+		t.Fatalf("expected the checksum to verify after an append, got %v, %v", ok, err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[3], checksumPrefix) {
+		t.Errorf("expected 3 records and a footer, got %v", lines)
+	}
+	db.opts.Strict = true
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Errorf("expected 2 matches, got %v", matches)
+	}
+
+	// Flip a byte
+	data, err := os.ReadFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	data[len("/path/to/file")] = '9'
+	if err := os.WriteFile(db.Path(), data, 0644); err != nil {
+		t.Fatalf("failed to write db: %v", err)
+	}
+	if ok, err := db.VerifyChecksum(); err != nil || ok {
+		t.Errorf("expected verification to fail, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,628 @@
+package catobase
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDBPath is the database used by the package-level helpers.
+const defaultDBPath = ".catodb"
+
+// defaultCopySuffix names the copy made beside a registered file.
+const defaultCopySuffix = ".copy"
+
+// Options configures a DB. The zero value matches the historical .catodb format.
+type Options struct {
+	// Separator delimits the fields of a record. Defaults to "|". Open
+	// rejects separators containing a comma, whitespace, which a header
+	// cannot name, or characters used in timestamps.
+	Separator string
+
+	// ReadSeparators lists further separators accepted when reading, for
+	// databases written by tools using a different separator. Each line is
+	// tried with Separator first and then with ReadSeparators in order; the
+	// first separator whose timestamp field parses wins, falling back to the
+	// first that yields enough fields. Writes always use Separator.
+	ReadSeparators []string
+
+	// Header writes a "#catobase v1 sep=..." line at the top of new and
+	// rewritten databases. A header already in the file is always kept, and
+	// its separator takes precedence over Separator for reads and writes.
+	Header bool
+
+	// Checksum ends rewritten databases with a "#sum=<sha256>" footer over
+	// the preceding contents, which VerifyChecksum checks to detect silent
+	// corruption. An append cannot update the footer in place, so with
+	// Checksum set every append rewrites the whole file, as it does for a
+	// compressed database; keep it for databases that are written rarely.
+	Checksum bool
+
+	// Strict makes reads fail on lines that do not parse as records instead
+	// of skipping them.
+	Strict bool
+
+	// Lock makes every write hold the "<db>.lock" file, so processes sharing
+	// the database do not interleave their writes. While the lock is held
+	// elsewhere a writer retries up to LockAttempts times (default 5),
+	// waiting LockDelay (default 10ms) and doubling the wait after each try.
+	Lock         bool
+	LockAttempts int
+	LockDelay    time.Duration
+
+	// Append selects how records are appended. The default, AppendInPlace,
+	// relies on O_APPEND writes being atomic, which some network
+	// filesystems do not guarantee; AppendStaged avoids that at a cost on
+	// reads.
+	Append AppendStrategy
+
+	// BulkLock makes bulk operations, such as RegisterFolder, hold the
+	// "<db>.lock" file from start to end, whether or not Lock is set. A bulk
+	// operation does not wait for the lock: if it is held, the operation
+	// fails at once with ErrLocked rather than interleave with another run.
+	BulkLock bool
+
+	// StaleLockAge, when positive, treats a lock file older than this as
+	// left behind by a crashed process and removes it before locking,
+	// unless the process recorded in it is still running. The lock is
+	// only judged on this machine: a lock held from another host over a
+	// shared filesystem is taken over once it is old enough.
+	StaleLockAge time.Duration
+
+	// CopySuffix is appended to a file's name to form the copy made beside
+	// it during registration. Defaults to ".copy". Walks skip files carrying
+	// the suffix so that earlier copies are not registered in turn.
+	CopySuffix string
+
+	// BackupRoot, when set, receives the copies made during registration
+	// instead of a suffixed file beside each original. A copy keeps the
+	// original's path relative to the database directory, so with the
+	// database in /data, /data/a/b.txt is copied to <BackupRoot>/a/b.txt.
+	// Files outside the database directory cannot be backed up this way.
+	BackupRoot string
+
+	// RecordCopyPath stores where the copy made during registration went in
+	// the record's metadata, under the "copy" key, so Record.CopyPath can
+	// find the backup later.
+	RecordCopyPath bool
+
+	// NormalizeNFC stores category names in Unicode normalization form C
+	// and compares them that way, so "café" typed with a combining accent
+	// matches the precomposed spelling. Existing records are normalized as
+	// they are read.
+	NormalizeNFC bool
+
+	// PruneUndated makes Prune also remove records whose timestamp does not
+	// parse. By default such records are kept.
+	PruneUndated bool
+
+	// Literal makes the path pattern of queries match as a plain substring,
+	// so "a.b(1)" finds exactly that text. Category patterns and the file
+	// name pattern of RegisterFiles are still regular expressions.
+	Literal bool
+
+	// IgnorePathCase compares paths case-insensitively, for databases of
+	// files on case-insensitive filesystems: a query for c:\docs\a.txt then
+	// finds C:\Docs\A.txt. Paths are still stored as registered.
+	IgnorePathCase bool
+
+	// BaseDir, when set, makes the database portable: paths are stored
+	// relative to it and resolved against it on read, so the whole tree can
+	// be moved and reopened with the new BaseDir. Files outside BaseDir
+	// cannot be registered. Records stored with absolute paths are read as is.
+	BaseDir string
+
+	// AllowMissing lets RegisterFile register paths that do not exist on
+	// disk yet, such as planned files. Their categories cannot be checked
+	// against the file, and they cannot be copied. By default the file must
+	// exist.
+	AllowMissing bool
+
+	// CopyPolicy decides per category whether files are copied when they
+	// are registered, overriding the copy argument of RegisterFile and
+	// WalkOptions.Copy: a file tagged "Archive" is always copied with
+	// {"Archive": true}, and never with {"Archive": false}. When the
+	// categories of a file disagree, copying wins. Files with none of the
+	// listed categories are copied as the caller asks.
+	CopyPolicy map[string]bool
+
+	// CreateDir creates the directory holding the database, and any missing
+	// parents, on the first write. By default writing to a database in a
+	// directory that does not exist fails.
+	CreateDir bool
+
+	// Implications names a rules file of "child -> parent" lines, read by
+	// Open. Category queries treat a record tagged with a child as carrying
+	// its parents too, transitively, so with "SciFi -> Fiction" a SciFi file
+	// matches a query for Fiction. The stored categories are not changed.
+	// Open fails if the rules form a cycle.
+	Implications string
+
+	// WriteBuffer, when positive, buffers registrations in memory and
+	// appends them in batches of this many records, see Flush.
+	WriteBuffer int
+
+	// Idempotent makes registering a file with exactly the categories of its
+	// latest record a no-op, so a retried registration does not add a
+	// second record. RegisterFile then reports false without an error.
+	Idempotent bool
+
+	// Confirm, when set, is asked before an operation that removes records
+	// (Prune, Clear and UnregisterByPattern) with the number it would
+	// remove. Returning false aborts the operation with ErrAborted, leaving
+	// the database untouched.
+	Confirm func(affected int) bool
+
+	// Logger receives debug-level entries for registrations, removals, lock
+	// waits and skipped malformed lines. Nothing is logged when it is nil.
+	Logger *slog.Logger
+}
+
+// DB is a handle on a catobase database file.
+type DB struct {
+	// gen counts writes made through this handle; it invalidates snapshots.
+	gen  uint64
+	path string
+	opts Options
+
+	// writeMu serializes writes made through this handle.
+	writeMu sync.Mutex
+
+	// copyPolicy is Options.CopyPolicy with normalized category names.
+	copyPolicy map[string]bool
+
+	// implies holds the rules loaded from Options.Implications.
+	implies implications
+
+	// buffer holds the registrations waiting for Flush; writeMu guards it.
+	buffer []string
+
+	// held is set while AcquireLock holds the database lock, and heldToken
+	// is the token it was taken with.
+	held      atomic.Bool
+	heldToken string
+
+	// claimed lists the staged files a writer holding writeMu works with,
+	// see claimStaged.
+	claimed atomic.Pointer[[]string]
+
+	// openFile opens the database file itself; tests replace it to watch
+	// how the database is opened and read.
+	openFile func(name string, flag int, perm os.FileMode) (storageFile, error)
+}
+
+// storageFile is the open database file, as returned by DB.openFile.
+type storageFile interface {
+	io.ReadWriteCloser
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// openOSFile is the default DB.openFile.
+func openOSFile(name string, flag int, perm os.FileMode) (storageFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// Open returns a DB backed by the file at path. A nil opts uses the defaults.
+// The file itself is not touched until an operation needs it.
+//
+// A path ending in ".gz" is read and written gzip-compressed. A gzip file
+// cannot be appended to, so each registration rewrites the whole database;
+// compression suits databases that are mostly read.
+func Open(path string, opts *Options) (*DB, error) {
+	db := &DB{path: path, openFile: openOSFile}
+	if opts != nil {
+		db.opts = *opts
+	}
+	if db.opts.Separator == "" {
+		db.opts.Separator = defaultSeparator
+	}
+	if db.opts.CopySuffix == "" {
+		db.opts.CopySuffix = defaultCopySuffix
+	}
+	if db.opts.BaseDir != "" {
+		base, err := filepath.Abs(db.opts.BaseDir)
+		if err != nil {
+			return nil, err
+		}
+		db.opts.BaseDir = base
+	}
+	for _, sep := range append([]string{db.opts.Separator}, db.opts.ReadSeparators...) {
+		if err := validateSeparator(sep); err != nil {
+			return nil, err
+		}
+	}
+	db.copyPolicy = make(map[string]bool, len(db.opts.CopyPolicy))
+	for c, policy := range db.opts.CopyPolicy {
+		name := db.normalize([]string{c})[0]
+		db.copyPolicy[name] = db.copyPolicy[name] || policy
+	}
+	if db.opts.Implications != "" {
+		rules, err := loadImplications(db.opts.Implications, db.normalize)
+		if err != nil {
+			return nil, err
+		}
+		db.implies = rules
+	}
+	return db, nil
+}
+
+// Path returns the location of the database file.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// rawLine is one line of the database as delivered by scanLines.
+type rawLine struct {
+	no     int    // 1-based line number
+	text   string // the line without its newline
+	header bool   // the line is the database header
+	footer bool   // the line is a checksum footer
+	rec    Record // the parsed record, if err is nil and header is false
+	err    error  // why the line is not a record
+}
+
+// scanLines calls fn for every line of the database, parsed but not
+// filtered. An unreadable header stops the scan with a *ParseError. If fn
+// returns ErrStop, scanning ends and scanLines returns nil.
+func (db *DB) scanLines(fn func(l rawLine) error) error {
+	file, err := db.openReader()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return db.readLines(file, fn)
+}
+
+// readLines is scanLines reading the database from r, which is read once
+// from start to end and never seeked.
+func (db *DB) readLines(r io.Reader, fn func(l rawLine) error) error {
+	sep := db.opts.Separator
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		l := rawLine{no: lineNo, text: scanner.Text()}
+		if lineNo == 1 {
+			h, ok, err := parseHeader(l.text)
+			if err != nil {
+				return &ParseError{Path: db.path, Line: lineNo, Text: l.text, Err: err}
+			}
+			if ok {
+				sep = h.sep
+				l.header = true
+			}
+		}
+		if !l.header && isChecksumLine(l.text) {
+			l.footer = true
+		}
+		if !l.header && !l.footer {
+			l.rec, l.err = db.parseLine(l.text, sep)
+			l.rec.Path = db.resolvePath(l.rec.Path)
+			l.rec.Categories = db.normalize(l.rec.Categories)
+		}
+		if err := fn(l); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// scan calls fn for each record in file order. Lines that do not parse are
+// skipped, or reported as an error naming the line in strict mode. If fn
+// returns ErrStop, scanning ends and scan returns nil.
+func (db *DB) scan(fn func(r Record) error) error {
+	return db.filterRecords(db.scanLines, fn)
+}
+
+// filterRecords calls fn for each record among the lines produced by lines,
+// as scan does.
+func (db *DB) filterRecords(lines func(fn func(l rawLine) error) error, fn func(r Record) error) error {
+	return lines(func(l rawLine) error {
+		if l.header || l.footer {
+			return nil
+		}
+		if l.err != nil {
+			if db.opts.Strict {
+				return &ParseError{Path: db.path, Line: l.no, Text: l.text, Err: l.err}
+			}
+			db.logger().Debug("skipped malformed line", "db", db.path, "line", l.no, "err", l.err)
+			return nil
+		}
+		return fn(l.rec)
+	})
+}
+
+// normalize applies the configured category normalization.
+func (db *DB) normalize(categories []string) []string {
+	if !db.opts.NormalizeNFC {
+		return categories
+	}
+	return normalizeCategories(categories)
+}
+
+// logger returns Options.Logger, or a logger discarding everything.
+func (db *DB) logger() *slog.Logger {
+	if db.opts.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return db.opts.Logger
+}
+
+// pathKey returns the form of path used to compare it with other paths.
+func (db *DB) pathKey(path string) string {
+	if !db.opts.IgnorePathCase {
+		return path
+	}
+	return strings.ToLower(path)
+}
+
+// lookupKey returns the key under which the records of path, as a caller
+// names it, are found: the path as it reads back from the database, mapped
+// through Options.BaseDir, then by pathKey. Compare it with pathKey of a
+// record's path.
+func (db *DB) lookupKey(path string) string {
+	if stored, ok := db.storedPath(path); ok {
+		path = db.resolvePath(stored)
+	}
+	return db.pathKey(path)
+}
+
+// storedPath returns path in the form it is written to the database:
+// relative to Options.BaseDir when that is set. It reports false if path lies
+// outside BaseDir.
+func (db *DB) storedPath(path string) (string, bool) {
+	if db.opts.BaseDir == "" {
+		return path, true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path, false
+	}
+	rel, err := filepath.Rel(db.opts.BaseDir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path, false
+	}
+	return rel, true
+}
+
+// storedPathOf is storedPath for a path about to be registered, failing for
+// one outside Options.BaseDir.
+func (db *DB) storedPathOf(path string) (string, error) {
+	stored, ok := db.storedPath(path)
+	if !ok {
+		return "", fmt.Errorf("cannot register %s: it is outside %s", path, db.opts.BaseDir)
+	}
+	return stored, nil
+}
+
+// resolvePath turns a path read from the database back into the form
+// callers use, joining it to Options.BaseDir when it is relative.
+func (db *DB) resolvePath(path string) string {
+	if db.opts.BaseDir == "" || path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(db.opts.BaseDir, path)
+}
+
+// parseLine parses a database line, trying sep and then the configured
+// read separators.
+func (db *DB) parseLine(line, sep string) (Record, error) {
+	r, err := ParseRecord(line, sep)
+	if len(db.opts.ReadSeparators) == 0 || (err == nil && !r.Registered.IsZero()) {
+		return r, err
+	}
+
+	for _, sep := range db.opts.ReadSeparators {
+		alt, altErr := ParseRecord(line, sep)
+		if altErr != nil {
+			continue
+		}
+		if !alt.Registered.IsZero() {
+			return alt, nil
+		}
+		if err != nil {
+			r, err = alt, nil
+		}
+	}
+	return r, err
+}
+
+// records reads every well-formed record in file order.
+func (db *DB) records() ([]Record, error) {
+	var records []Record
+	err := db.scan(func(r Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// strayLine is a database line that does not parse as a record. after is
+// the number of records before it.
+type strayLine struct {
+	after int
+	text  string
+}
+
+// recordsAndStrays reads every well-formed record in file order, as records
+// does, along with the lines that do not parse, so a rewrite can keep them.
+func (db *DB) recordsAndStrays() ([]Record, []strayLine, error) {
+	var records []Record
+	var strays []strayLine
+	err := db.scanLines(func(l rawLine) error {
+		switch {
+		case l.header || l.footer:
+		case l.err != nil:
+			if db.opts.Strict {
+				return &ParseError{Path: db.path, Line: l.no, Text: l.text, Err: l.err}
+			}
+			if strings.TrimSpace(l.text) != "" {
+				strays = append(strays, strayLine{after: len(records), text: l.text})
+			}
+		default:
+			records = append(records, l.rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return records, strays, nil
+}
+
+// appendLines appends already formatted records to the database, creating
+// it, with a header if one is wanted, when it does not exist yet. The caller
+// holds the write lock.
+func (db *DB) appendLines(lines []string) error {
+	a, err := db.openAppender()
+	if err != nil {
+		return err
+	}
+	if err := a.write(lines...); err != nil {
+		a.close()
+		return err
+	}
+	return a.close()
+}
+
+// errUnchanged can be returned from an update callback to skip the rewrite.
+var errUnchanged = errors.New("unchanged")
+
+// update rewrites the database with the records fn returns for the current
+// ones, holding the write lock throughout so no write is lost in between.
+// Lines that do not parse as records are written back unchanged, near where
+// they were.
+func (db *DB) update(fn func(records []Record) ([]Record, error)) error {
+	return db.withWriteLock(func() error {
+		records, strays, err := db.recordsAndStrays()
+		if err != nil {
+			return err
+		}
+		records, err = fn(records)
+		if err != nil {
+			if errors.Is(err, errUnchanged) {
+				return nil
+			}
+			return err
+		}
+		return db.rewrite(records, strays)
+	})
+}
+
+// rewrite atomically replaces the database contents with records, keeping
+// or adding the header as configured. Each of strays is written before the
+// record it preceded, or at the end if fewer records remain.
+func (db *DB) rewrite(records []Record, strays []strayLine) error {
+	h, hasHeader, sep, err := db.rewriteHeader()
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	if hasHeader {
+		lines = append(lines, h.String())
+	}
+	for i, r := range records {
+		for len(strays) > 0 && strays[0].after <= i {
+			lines = append(lines, strays[0].text)
+			strays = strays[1:]
+		}
+		// Paths outside BaseDir were stored absolute and stay that way
+		r.Path, _ = db.storedPath(r.Path)
+		lines = append(lines, formatRecord(r, sep))
+	}
+	for _, s := range strays {
+		lines = append(lines, s.text)
+	}
+	return db.writeFile(lines)
+}
+
+// rewriteHeader returns the header a rewrite starts with, if any, and the
+// separator it writes records with: the existing header is kept, or one is
+// added when Options.Header is set.
+func (db *DB) rewriteHeader() (header, bool, string, error) {
+	h, hasHeader, err := db.readHeader()
+	if err != nil {
+		return header{}, false, "", err
+	}
+	if !hasHeader && db.opts.Header {
+		h, hasHeader = header{version: formatVersion, sep: db.opts.Separator}, true
+	}
+	if hasHeader {
+		return h, true, h.sep, nil
+	}
+	return h, false, db.opts.Separator, nil
+}
+
+// invalidate marks snapshots taken before a write as stale.
+func (db *DB) invalidate() {
+	atomic.AddUint64(&db.gen, 1)
+}
+
+// Canonicalize rewrites the database with records sorted by path and the
+// categories of each record sorted, giving a stable, diff-friendly file.
+// Records sharing a path keep their relative order. Malformed lines are dropped.
+func (db *DB) Canonicalize() error {
+	return db.withWriteLock(func() error {
+		records, err := db.records()
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			sort.Strings(r.Categories)
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Path < records[j].Path
+		})
+		return db.rewrite(records, nil)
+	})
+}
+
+// ErrAborted is returned when Options.Confirm declines an operation.
+var ErrAborted = errors.New("operation aborted")
+
+// confirm asks Options.Confirm whether to remove affected records.
+func (db *DB) confirm(affected int) error {
+	if db.opts.Confirm == nil || db.opts.Confirm(affected) {
+		return nil
+	}
+	return ErrAborted
+}
+
+// Clear removes every record while keeping the database file, and its header
+// if it has one, in place. A missing database is created empty.
+func (db *DB) Clear() error {
+	return db.withWriteLock(func() error {
+		if db.opts.Confirm != nil {
+			records, err := db.records()
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if err := db.confirm(len(records)); err != nil {
+				return err
+			}
+		}
+		if err := db.rewrite(nil, nil); err != nil {
+			return err
+		}
+		db.buffer = nil
+		db.logger().Debug("cleared database", "db", db.path)
+		return nil
+	})
+}
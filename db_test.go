@@ -0,0 +1,236 @@
+package catobase
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Helper function to open a DB on a fresh database seeded with lines.
+func openTestDB(t *testing.T, lines []string, opts *Options) *DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".catodb")
+	if lines != nil {
+		setupTestFile(t, path, lines)
+	}
+	db, err := Open(path, opts)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	return db
+}
+
+func TestCanonicalize(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file2|Music,Games|2023-07-02T00:00:00Z",
+		"/path/to/file1|Movies,Books|2023-07-01T00:00:00Z",
+		"/path/to/file3|Zines|2023-07-03T00:00:00Z",
+	}, nil)
+
+	if err := db.Canonicalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	expected := []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Games,Music|2023-07-02T00:00:00Z",
+		"/path/to/file3|Zines|2023-07-03T00:00:00Z",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("expected line %d to be %q, got %q", i, expected[i], line)
+		}
+	}
+}
+
+func TestOpenRejectsCommaSeparator(t *testing.T) {
+	if _, err := Open(".catodb", &Options{Separator: ","}); err == nil {
+		t.Errorf("expected error for a comma separator")
+	}
+	// A header cannot name a whitespace separator
+	if _, err := Open(".catodb", &Options{Separator: " ", Header: true}); err == nil {
+		t.Errorf("expected error for a space separator")
+	}
+	if _, err := Open(".catodb", &Options{ReadSeparators: []string{":"}}); err == nil {
+		t.Errorf("expected error for a separator found in timestamps")
+	}
+}
+
+func TestReadSeparators(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2#Books#2023-07-01T00:00:00Z",
+		"/path/with|bar#Books#2023-07-01T00:00:00Z",
+	}, &Options{ReadSeparators: []string{"#"}})
+
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"/path/to/file1", "/path/to/file2", "/path/with|bar"}
+	if strings.Join(matches, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected matches %v, got %v", expected, matches)
+	}
+
+	// Without the extra separator only the first line is readable
+	db, err = Open(db.Path(), nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	matches, err = db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected 1 match, got %v", matches)
+	}
+}
+
+func TestClear(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	if err := db.Clear(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(db.Path()); err != nil {
+		t.Errorf("expected db file to still exist: %v", err)
+	}
+	matches, err := db.Get(".*", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected no matches after Clear, got %v", matches)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	db := openTestDB(t, []string{"not a record"}, &Options{Logger: logger})
+
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.Get(".*", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logged := buf.String()
+	if !strings.Contains(logged, `msg="registered file"`) || !strings.Contains(logged, "path="+testFile) {
+		t.Errorf("expected a registration entry, got %q", logged)
+	}
+	if !strings.Contains(logged, `msg="skipped malformed line"`) {
+		t.Errorf("expected a malformed line entry, got %q", logged)
+	}
+}
+
+func TestBaseDir(t *testing.T) {
+	root := t.TempDir()
+	base := filepath.Join(root, "tree")
+	file := filepath.Join(base, "docs", "a.txt")
+	os.MkdirAll(filepath.Dir(file), 0755)
+	setupTestFile(t, file, []string{"Books"})
+
+	db, err := Open(filepath.Join(base, ".catodb"), &Options{BaseDir: base})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if !strings.HasPrefix(lines[0], filepath.Join("docs", "a.txt")+"|") {
+		t.Errorf("expected a relative path to be stored, got %q", lines[0])
+	}
+
+	outside := filepath.Join(root, "b.txt")
+	setupTestFile(t, outside, []string{"Books"})
+	if _, err := db.RegisterFile(outside, []string{"Books"}, false); err == nil {
+		t.Errorf("expected error for a file outside the base directory")
+	}
+
+	// Move the whole tree and look the file up under its new location
+	moved := filepath.Join(root, "moved")
+	if err := os.Rename(base, moved); err != nil {
+		t.Fatalf("failed to move tree: %v", err)
+	}
+	db, err = Open(filepath.Join(moved, ".catodb"), &Options{BaseDir: moved})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	movedFile := filepath.Join(moved, "docs", "a.txt")
+	ok, err := db.IsRegistered(movedFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Errorf("expected %s to be registered after the move", movedFile)
+	}
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != movedFile {
+		t.Errorf("expected [%s], got %v", movedFile, matches)
+	}
+}
+
+func TestBaseDirRelativeLookups(t *testing.T) {
+	base := t.TempDir()
+	os.MkdirAll(filepath.Join(base, "docs"), 0755)
+	setupTestFile(t, filepath.Join(base, "docs", "a.txt"), []string{"Books", "Music"})
+	setupTestFile(t, filepath.Join(base, "docs", "c.txt"), []string{"Books"})
+	t.Chdir(base)
+
+	db, err := Open(filepath.Join(base, ".catodb"), &Options{BaseDir: base})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	for _, file := range []string{"docs/a.txt", "docs/c.txt"} {
+		if _, err := db.RegisterFile(file, []string{"Books"}, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if ok, err := db.IsRegistered("docs/a.txt"); err != nil || !ok {
+		t.Errorf("expected docs/a.txt to be registered, got %v, %v", ok, err)
+	}
+	if records, err := db.GetPaths([]string{"docs/a.txt"}); err != nil || len(records) != 1 {
+		t.Errorf("expected a record for docs/a.txt, got %v, %v", records, err)
+	}
+	if _, err := db.Describe("docs/a.txt"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if related, err := db.Related("docs/a.txt", 1); err != nil || len(related) != 1 {
+		t.Errorf("expected docs/c.txt to be related, got %v, %v", related, err)
+	}
+	if ok, err := db.SetCategories("docs/a.txt", []string{"Books", "Music"}); err != nil || !ok {
+		t.Errorf("expected SetCategories to find docs/a.txt, got %v, %v", ok, err)
+	}
+	if ok, err := db.RelocateRecord("docs/a.txt", "docs/b.txt"); err != nil || !ok {
+		t.Errorf("expected RelocateRecord to find docs/a.txt, got %v, %v", ok, err)
+	}
+	if ok, _ := db.IsRegistered("docs/b.txt"); !ok {
+		t.Errorf("expected docs/b.txt to be registered after the move")
+	}
+}
@@ -0,0 +1,39 @@
+package catobase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// describeTimeLayout renders registration times in Describe.
+const describeTimeLayout = "2006-01-02 15:04:05 MST"
+
+// Describe returns a human-readable description of the latest record for
+// path: the path, its categories one per line, and when it was registered,
+// in the local time zone. It returns ErrNotRegistered if path has no record.
+func (db *DB) Describe(path string) (string, error) {
+	records, err := db.GetPaths([]string{path})
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", ErrNotRegistered
+	}
+	r := records[0]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Path: %s\n", r.Path)
+	b.WriteString("Categories:\n")
+	if len(r.Categories) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, c := range r.Categories {
+		fmt.Fprintf(&b, "  %s\n", c)
+	}
+	registered := "unknown"
+	if !r.Registered.IsZero() {
+		registered = r.Registered.Local().Format(describeTimeLayout)
+	}
+	fmt.Fprintf(&b, "Registered: %s\n", registered)
+	return b.String(), nil
+}
@@ -0,0 +1,32 @@
+package catobase
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDescribe(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file1|Books,Movies|2023-07-02T10:30:00Z",
+	}, nil)
+
+	got, err := db.Describe("/path/to/file1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	registered := time.Date(2023, 7, 2, 10, 30, 0, 0, time.UTC).Local().Format("2006-01-02 15:04:05 MST")
+	expected := "Path: /path/to/file1\n" +
+		"Categories:\n" +
+		"  Books\n" +
+		"  Movies\n" +
+		"Registered: " + registered + "\n"
+	if got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if _, err := db.Describe("/path/to/missing"); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package catobase
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ExportMatchesList writes the paths Get would return for regex and
+// categories to w, one per line, for feeding to tools such as xargs.
+func (db *DB) ExportMatchesList(w io.Writer, regex string, categories []string) error {
+	matches, err := db.Get(regex, categories)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, path := range matches {
+		bw.WriteString(path + "\n")
+	}
+	return bw.Flush()
+}
+
+// ExportDOT writes the categories as an undirected Graphviz graph, to be
+// rendered with dot. Every category in use is a node; two categories are
+// joined by an edge weighted, and labelled, with their CoOccurrence count
+// when it is at least minWeight. Nodes and edges are written sorted, so the
+// output is stable.
+func (db *DB) ExportDOT(w io.Writer, minWeight int) error {
+	counts, err := db.CategoryCounts()
+	if err != nil {
+		return err
+	}
+	pairs, err := db.CoOccurrence()
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]string, 0, len(counts))
+	for name := range counts {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	edges := make([][2]string, 0, len(pairs))
+	for pair, weight := range pairs {
+		if weight >= minWeight {
+			edges = append(edges, pair)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("graph categories {\n")
+	for _, name := range nodes {
+		fmt.Fprintf(bw, "\t%q;\n", name)
+	}
+	for _, e := range edges {
+		fmt.Fprintf(bw, "\t%q -- %q [weight=%d, label=\"%d\"];\n", e[0], e[1], pairs[e], pairs[e])
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
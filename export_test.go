@@ -0,0 +1,48 @@
+package catobase
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExportMatchesList(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|Books|2023-07-01T00:00:00Z",
+		"/path/to/file1|Books|2023-07-02T00:00:00Z",
+	}, nil)
+
+	var buf bytes.Buffer
+	if err := db.ExportMatchesList(&buf, ".*", []string{"Books"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "/path/to/file1\n/path/to/file3\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books,Music,Sci \"Fi\"|2023-07-01T00:00:00Z",
+		"/path/to/file3|Games|2023-07-01T00:00:00Z",
+	}, nil)
+
+	var buf bytes.Buffer
+	if err := db.ExportDOT(&buf, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `graph categories {
+	"Books";
+	"Games";
+	"Music";
+	"Sci \"Fi\"";
+	"Books" -- "Music" [weight=2, label="2"];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
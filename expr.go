@@ -0,0 +1,194 @@
+package catobase
+
+import "fmt"
+
+// Predicate reports whether a record with the given categories is wanted.
+type Predicate func(categories CategorySet) bool
+
+// QueryError reports a tag expression that does not parse. Pos is the
+// 1-based byte column of the offending token.
+type QueryError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query %q at column %d: %s", e.Expr, e.Pos, e.Msg)
+}
+
+// token is one word or parenthesis of a tag expression.
+type token struct {
+	text string
+	pos  int // 1-based byte column
+}
+
+// tokenize splits expr into parentheses and whitespace-separated words.
+func tokenize(expr string) []token {
+	var tokens []token
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, token{text: expr[start:end], pos: start + 1})
+			start = -1
+		}
+	}
+	for i, c := range expr {
+		switch {
+		case c == '(' || c == ')':
+			flush(i)
+			tokens = append(tokens, token{text: string(c), pos: i + 1})
+		case c == ' ' || c == '\t' || c == '\n':
+			flush(i)
+		case start < 0:
+			start = i
+		}
+	}
+	flush(len(expr))
+	return tokens
+}
+
+// exprParser is a recursive descent parser over the tokens of an expression.
+type exprParser struct {
+	expr   string
+	tokens []token
+	next   int
+}
+
+// ParseQuery parses a tag expression such as
+// "Books AND (Fiction OR SciFi) NOT Draft" into a Predicate. Tags are
+// combined with the upper-case operators NOT, AND and OR, binding in that
+// order, and grouped with parentheses. Adjacent terms are joined by AND, so
+// "Books NOT Draft" is "Books AND NOT Draft". Errors are *QueryError values
+// giving the position of the problem.
+func ParseQuery(expr string) (Predicate, error) {
+	p := &exprParser{expr: expr, tokens: tokenize(expr)}
+	if len(p.tokens) == 0 {
+		return nil, &QueryError{Expr: expr, Pos: 1, Msg: "empty query"}
+	}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		if t.text == ")" {
+			return nil, p.errorAt(t, "unmatched )")
+		}
+		return nil, p.errorAt(t, fmt.Sprintf("unexpected %q", t.text))
+	}
+	return pred, nil
+}
+
+func (p *exprParser) peek() (token, bool) {
+	if p.next >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+func (p *exprParser) errorAt(t token, msg string) error {
+	return &QueryError{Expr: p.expr, Pos: t.pos, Msg: msg}
+}
+
+// errorAtEnd reports a problem found when the input ran out.
+func (p *exprParser) errorAtEnd(msg string) error {
+	return &QueryError{Expr: p.expr, Pos: len(p.expr) + 1, Msg: msg}
+}
+
+func (p *exprParser) parseOr() (Predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.text != "OR" {
+			return left, nil
+		}
+		p.next++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c CategorySet) bool { return l(c) || right(c) }
+	}
+}
+
+func (p *exprParser) parseAnd() (Predicate, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.text == "OR" || t.text == ")" {
+			return left, nil
+		}
+		if t.text == "AND" {
+			p.next++
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c CategorySet) bool { return l(c) && right(c) }
+	}
+}
+
+func (p *exprParser) parseNot() (Predicate, error) {
+	t, ok := p.peek()
+	if ok && t.text == "NOT" {
+		p.next++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(c CategorySet) bool { return !operand(c) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Predicate, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorAtEnd("expected a category")
+	}
+	switch t.text {
+	case "(":
+		p.next++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return nil, p.errorAt(t, "unmatched (")
+		}
+		p.next++
+		return inner, nil
+	case ")", "AND", "OR":
+		return nil, p.errorAt(t, fmt.Sprintf("expected a category, got %q", t.text))
+	}
+	p.next++
+	name := t.text
+	return func(c CategorySet) bool { return c.Has(name) }, nil
+}
+
+// Match returns the paths matching regex whose record satisfies pred, with
+// the same rules as Get otherwise.
+func (db *DB) Match(regex string, pred Predicate) ([]string, error) {
+	return db.matchPaths(regex, func(r Record) bool {
+		return pred(db.expand(r.Categories))
+	})
+}
+
+// MatchQuery is Match with a predicate parsed from a tag expression by
+// ParseQuery.
+func (db *DB) MatchQuery(regex string, expr string) ([]string, error) {
+	pred, err := ParseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	return db.Match(regex, pred)
+}
@@ -0,0 +1,76 @@
+package catobase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseQueryPrecedence(t *testing.T) {
+	cases := []struct {
+		expr       string
+		categories []string
+		expected   bool
+	}{
+		// AND binds tighter than OR
+		{"Books OR Music AND Draft", []string{"Books"}, true},
+		{"Books OR Music AND Draft", []string{"Music"}, false},
+		{"(Books OR Music) AND Draft", []string{"Books"}, false},
+		// NOT binds tighter than AND
+		{"NOT Books AND Music", []string{"Music"}, true},
+		{"NOT Books AND Music", []string{"Books", "Music"}, false},
+		{"NOT (Books AND Music)", []string{"Books"}, true},
+		// Adjacent terms are joined by AND
+		{"Books AND (Fiction OR SciFi) NOT Draft", []string{"Books", "SciFi"}, true},
+		{"Books AND (Fiction OR SciFi) NOT Draft", []string{"Books", "SciFi", "Draft"}, false},
+		{"Books AND (Fiction OR SciFi) NOT Draft", []string{"Books"}, false},
+	}
+	for _, c := range cases {
+		pred, err := ParseQuery(c.expr)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.expr, err)
+		}
+		if got := pred(NewCategorySet(c.categories...)); got != c.expected {
+			t.Errorf("%q on %v: expected %v, got %v", c.expr, c.categories, c.expected, got)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	cases := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{"(Books OR Music", 1, "unmatched ("},
+		{"Books OR Music)", 15, "unmatched )"},
+		{"Books AND", 10, "expected a category"},
+		{"", 1, "empty query"},
+	}
+	for _, c := range cases {
+		_, err := ParseQuery(c.expr)
+		var qerr *QueryError
+		if !errors.As(err, &qerr) {
+			t.Fatalf("%q: expected a *QueryError, got %v", c.expr, err)
+		}
+		if qerr.Pos != c.pos || !strings.Contains(qerr.Msg, c.msg) {
+			t.Errorf("%q: expected %q at column %d, got %v", c.expr, c.msg, c.pos, err)
+		}
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Fiction|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books,SciFi,Draft|2023-07-01T00:00:00Z",
+		"/path/to/file3|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	matches, err := db.MatchQuery(".*", "Books AND (Fiction OR SciFi) NOT Draft")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/file1" {
+		t.Errorf("expected [/path/to/file1], got %v", matches)
+	}
+}
@@ -1 +1,10 @@
-module github.com/Orlando0309/catobase
\ No newline at end of file
+module github.com/Orlando0309/catobase
+
+go 1.24.0
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	golang.org/x/text v0.34.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
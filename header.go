@@ -0,0 +1,92 @@
+package catobase
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// headerPrefix starts the optional first line of a database, which records
+// the format version and separator, e.g. "#catobase v1 sep=|".
+const headerPrefix = "#catobase"
+
+// formatVersion is the newest database format this package understands.
+const formatVersion = 1
+
+// header is the parsed form of a database header line.
+type header struct {
+	version int
+	sep     string
+}
+
+// parseHeader parses line as a header. It reports false if line is not one.
+func parseHeader(line string) (header, bool, error) {
+	if !strings.HasPrefix(line, headerPrefix+" ") {
+		return header{}, false, nil
+	}
+
+	var h header
+	for _, field := range strings.Fields(line[len(headerPrefix):]) {
+		switch {
+		case strings.HasPrefix(field, "sep="):
+			h.sep = strings.TrimPrefix(field, "sep=")
+		case strings.HasPrefix(field, "v"):
+			v, err := strconv.Atoi(field[1:])
+			if err != nil {
+				return header{}, false, fmt.Errorf("invalid header version %q", field)
+			}
+			h.version = v
+		}
+	}
+	if h.version == 0 {
+		return header{}, false, errors.New("header is missing a version")
+	}
+	if h.version > formatVersion {
+		return header{}, false, fmt.Errorf("unsupported database version %d", h.version)
+	}
+	if h.sep == "" {
+		h.sep = defaultSeparator
+	}
+	return h, true, nil
+}
+
+// String renders h as a header line.
+func (h header) String() string {
+	return fmt.Sprintf("%s v%d sep=%s", headerPrefix, h.version, h.sep)
+}
+
+// readHeader returns the header of the database file, if it has one.
+// A missing database has no header.
+func (db *DB) readHeader() (header, bool, error) {
+	file, err := db.openReader()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return header{}, false, nil
+		}
+		return header{}, false, err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return header{}, false, err
+	}
+	return parseHeader(strings.TrimSuffix(line, "\n"))
+}
+
+// separator returns the separator records are written with: the one named
+// in the database header if there is one, otherwise Options.Separator.
+func (db *DB) separator() (string, error) {
+	h, ok, err := db.readHeader()
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return h.sep, nil
+	}
+	return db.opts.Separator, nil
+}
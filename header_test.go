@@ -0,0 +1,77 @@
+package catobase
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadHeaderedDB(t *testing.T) {
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=#",
+		"/path/to/file1#Books,Movies#2023-07-01T00:00:00Z",
+		"/path/to/file2#Music#2023-07-01T00:00:00Z",
+	}, nil)
+
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/file1" {
+		t.Errorf("expected /path/to/file1, got %v", matches)
+	}
+
+	// Rewrites keep the header and its separator
+	if err := db.Canonicalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if lines[0] != "#catobase v1 sep=#" || lines[1] != "/path/to/file1#Books,Movies#2023-07-01T00:00:00Z" {
+		t.Errorf("expected header and separator to be kept, got %v", lines)
+	}
+}
+
+func TestReadHeaderlessDB(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+	}, nil)
+
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected 1 match, got %v", matches)
+	}
+}
+
+func TestUnsupportedHeaderVersion(t *testing.T) {
+	db := openTestDB(t, []string{"#catobase v99 sep=|"}, nil)
+
+	if _, err := db.Get(".*", nil); err == nil {
+		t.Errorf("expected error for an unsupported version")
+	}
+}
+
+func TestRegisterWritesHeader(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, nil, &Options{Header: true, Separator: ";"})
+
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 3 || lines[0] != "#catobase v1 sep=;" {
+		t.Errorf("expected a single header followed by 2 records, got %v", lines)
+	}
+}
@@ -0,0 +1,69 @@
+package catobase
+
+// HealthReport summarizes the state of a database file.
+type HealthReport struct {
+	Lines          int // every line, including a header
+	Records        int // lines that parse as records
+	Malformed      int // lines that are neither a record nor the header
+	DuplicatePaths int // paths with more than one record
+	// ReclaimableBytes estimates what compacting would save by keeping
+	// only the latest record of each path and dropping malformed lines.
+	ReclaimableBytes int64
+}
+
+// Health scans the database once and reports its size and fragmentation,
+// to help decide when it is worth compacting.
+func (db *DB) Health() (HealthReport, error) {
+	var report HealthReport
+	total := make(map[string]int64)  // bytes of all records per path
+	latest := make(map[string]int64) // bytes of the latest record per path
+	counts := make(map[string]int)
+	err := db.scanLines(func(l rawLine) error {
+		report.Lines++
+		size := int64(len(l.text)) + 1
+		switch {
+		case l.header, l.footer:
+		case l.err != nil:
+			report.Malformed++
+			report.ReclaimableBytes += size
+		default:
+			report.Records++
+			p := db.pathKey(l.rec.Path)
+			counts[p]++
+			total[p] += size
+			latest[p] = size
+		}
+		return nil
+	})
+	if err != nil {
+		return HealthReport{}, err
+	}
+
+	for p, n := range counts {
+		if n > 1 {
+			report.DuplicatePaths++
+			report.ReclaimableBytes += total[p] - latest[p]
+		}
+	}
+	return report, nil
+}
+
+// CheckUniquePaths returns the paths that have more than one record, in the
+// order they first appear, without changing anything. MergeDuplicates
+// collapses them.
+func (db *DB) CheckUniquePaths() ([]string, error) {
+	var duplicates []string
+	counts := make(map[string]int)
+	err := db.scan(func(r Record) error {
+		key := db.pathKey(r.Path)
+		counts[key]++
+		if counts[key] == 2 {
+			duplicates = append(duplicates, r.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
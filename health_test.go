@@ -0,0 +1,76 @@
+package catobase
+
+import "testing"
+
+func TestHealth(t *testing.T) {
+	old1 := "/a|Books|2023-07-01T00:00:00Z"
+	old2 := "/a|Books,Movies|2023-07-02T00:00:00Z"
+	bad := "garbage"
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=|",
+		old1,
+		"/b|Music|2023-07-01T00:00:00Z",
+		old2,
+		bad,
+		"/a|Movies|2023-07-03T00:00:00Z",
+		"/b|Games|2023-07-03T00:00:00Z",
+		"/c|Games|2023-07-03T00:00:00Z",
+	}, nil)
+
+	report, err := db.Health()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Lines != 8 {
+		t.Errorf("expected 8 lines, got %d", report.Lines)
+	}
+	if report.Records != 6 {
+		t.Errorf("expected 6 records, got %d", report.Records)
+	}
+	if report.Malformed != 1 {
+		t.Errorf("expected 1 malformed line, got %d", report.Malformed)
+	}
+	if report.DuplicatePaths != 2 {
+		t.Errorf("expected 2 duplicate paths, got %d", report.DuplicatePaths)
+	}
+	// The two older /a records, the older /b record and the bad line go
+	expected := int64(len(old1) + len(old2) + len("/b|Music|2023-07-01T00:00:00Z") + len(bad) + 4)
+	if report.ReclaimableBytes != expected {
+		t.Errorf("expected %d reclaimable bytes, got %d", expected, report.ReclaimableBytes)
+	}
+}
+
+func TestHealthIgnorePathCase(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/A|Books|2023-07-01T00:00:00Z",
+		"/a|Books|2023-07-02T00:00:00Z",
+	}, &Options{IgnorePathCase: true})
+
+	report, err := db.Health()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.DuplicatePaths != 1 {
+		t.Errorf("expected 1 duplicate path, got %d", report.DuplicatePaths)
+	}
+}
+
+func TestCheckUniquePaths(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books|2023-07-01T00:00:00Z",
+		"/path/to/file3|Music|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-02T00:00:00Z",
+		"/path/to/file4|Music|2023-07-01T00:00:00Z",
+		"/path/to/file2|Games|2023-07-03T00:00:00Z",
+	}, nil)
+
+	duplicates, err := db.CheckUniquePaths()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(duplicates) != 1 || duplicates[0] != "/path/to/file2" {
+		t.Errorf("expected [/path/to/file2], got %v", duplicates)
+	}
+}
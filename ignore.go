@@ -0,0 +1,86 @@
+package catobase
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is read from the root of a folder passed to registerFiles.
+const ignoreFileName = ".catoignore"
+
+// ignorePattern is one line of a .catoignore file.
+type ignorePattern struct {
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreRules holds the patterns of a .catoignore file. It follows the common
+// subset of gitignore: "#" comments, "!" negation, a trailing "/" for
+// directories only, and a leading or inner "/" to anchor a pattern to the
+// folder root. Unanchored patterns match the base name at any depth. "**" is
+// not supported. The last matching pattern wins.
+type ignoreRules struct {
+	patterns []ignorePattern
+}
+
+// loadIgnore reads folder/.catoignore. A missing file yields no rules.
+func loadIgnore(folder string) (*ignoreRules, error) {
+	lines, err := readFile(filepath.Join(folder, ignoreFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &ignoreRules{}, nil
+		}
+		return nil, err
+	}
+
+	rules := &ignoreRules{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, err
+		}
+		p.glob = line
+		rules.patterns = append(rules.patterns, p)
+	}
+	return rules, nil
+}
+
+// match reports whether rel, a slash-separated path relative to the folder
+// root, is ignored.
+func (r *ignoreRules) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range r.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if !p.anchored {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(p.glob, name); ok {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,69 @@
+package catobase
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	folder := t.TempDir()
+	setupTestFile(t, filepath.Join(folder, ignoreFileName), []string{
+		"# build output",
+		"drafts/",
+		"*.tmp",
+		"!keep.tmp",
+		"/top.txt",
+	})
+
+	rules, err := loadIgnore(folder)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"drafts", true, true},
+		{"a/drafts", true, true},
+		{"drafts", false, false},
+		{"a/b.tmp", false, true},
+		{"a/keep.tmp", false, false},
+		{"top.txt", false, true},
+		{"a/top.txt", false, false},
+		{"a/b.txt", false, false},
+	}
+	for _, c := range cases {
+		if got := rules.match(c.rel, c.isDir); got != c.ignored {
+			t.Errorf("match(%q, %v) = %v, expected %v", c.rel, c.isDir, got, c.ignored)
+		}
+	}
+}
+
+func TestRegisterFilesHonorsIgnoreFile(t *testing.T) {
+	folder := "test_ignore_folder"
+	os.MkdirAll(filepath.Join(folder, "drafts"), 0755)
+	defer os.RemoveAll(folder)
+
+	setupTestFile(t, filepath.Join(folder, "file1.txt"), []string{"Books"})
+	setupTestFile(t, filepath.Join(folder, "drafts", "file2.txt"), []string{"Music"})
+	setupTestFile(t, filepath.Join(folder, ignoreFileName), []string{"drafts/"})
+
+	dbFile := ".catodb"
+	setupTestFile(t, dbFile, nil)
+	defer cleanupTestFile(t, dbFile)
+
+	registeredFiles, err := registerFiles(folder, ".*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(registeredFiles) != 1 {
+		t.Fatalf("expected 1 registered file, got %d: %v", len(registeredFiles), registeredFiles)
+	}
+	if registeredFiles[0] != filepath.Join(folder, "file1.txt") {
+		t.Errorf("expected file1.txt to be registered, got %s", registeredFiles[0])
+	}
+}
@@ -0,0 +1,110 @@
+package catobase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// implicationArrow separates a child category from its parent in a rules
+// file line.
+const implicationArrow = "->"
+
+// implications maps a category to the categories it implies.
+type implications map[string][]string
+
+// loadImplications reads a rules file of "child -> parent" lines. Blank
+// lines and lines starting with "#" are skipped. A file whose rules form a
+// cycle, such as "A -> B" and "B -> A", is rejected.
+func loadImplications(fileName string, normalize func([]string) []string) (implications, error) {
+	lines, err := readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(implications)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		child, parent, ok := strings.Cut(line, implicationArrow)
+		child, parent = strings.TrimSpace(child), strings.TrimSpace(parent)
+		if !ok || child == "" || parent == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"child %s parent\", got %q", fileName, i+1, implicationArrow, line)
+		}
+		names := normalize([]string{child, parent})
+		rules[names[0]] = append(rules[names[0]], names[1])
+	}
+	if cycle := rules.cycle(); cycle != nil {
+		return nil, fmt.Errorf("%s: implication cycle %s", fileName, strings.Join(cycle, " "+implicationArrow+" "))
+	}
+	return rules, nil
+}
+
+// cycle returns the categories along a cycle of rules, starting and ending
+// with the same one, or nil if there is none.
+func (rules implications) cycle() []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(c string) []string
+	visit = func(c string) []string {
+		switch state[c] {
+		case visiting:
+			for i, p := range path {
+				if p == c {
+					return append(append([]string(nil), path[i:]...), c)
+				}
+			}
+		case done:
+			return nil
+		}
+		state[c] = visiting
+		path = append(path, c)
+		for _, parent := range rules[c] {
+			if cycle := visit(parent); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[c] = done
+		return nil
+	}
+
+	for _, c := range NewCategorySet(rules.children()...).Slice() {
+		if cycle := visit(c); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// children returns the categories that imply others.
+func (rules implications) children() []string {
+	children := make([]string, 0, len(rules))
+	for c := range rules {
+		children = append(children, c)
+	}
+	return children
+}
+
+// expand returns categories with every category they imply, directly or
+// through other rules, added. categories itself is left alone.
+func (db *DB) expand(categories []string) CategorySet {
+	set := NewCategorySet(categories...)
+	pending := append([]string(nil), categories...)
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, parent := range db.implies[c] {
+			if !set.Has(parent) {
+				set.Add(parent)
+				pending = append(pending, parent)
+			}
+		}
+	}
+	return set
+}
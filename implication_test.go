@@ -0,0 +1,110 @@
+package catobase
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImplications(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.txt")
+	setupTestFile(t, rules, []string{
+		"# genre tree",
+		"SciFi -> Fiction",
+		"",
+		"Fiction -> Books",
+	})
+	db := openTestDB(t, []string{
+		"/path/to/dune|SciFi|2023-07-01T00:00:00Z",
+		"/path/to/atlas|Maps|2023-07-01T00:00:00Z",
+	}, &Options{Implications: rules})
+
+	for _, query := range [][]string{{"Fiction"}, {"Books", "SciFi"}} {
+		matches, err := db.Get(".*", query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(matches) != 1 || matches[0] != "/path/to/dune" {
+			t.Errorf("expected %v to match [/path/to/dune], got %v", query, matches)
+		}
+	}
+
+	matches, err := db.MatchQuery(".*", "Books AND NOT Maps")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/dune" {
+		t.Errorf("expected [/path/to/dune], got %v", matches)
+	}
+
+	// The stored categories are left alone
+	records, err := db.GetPaths([]string{"/path/to/dune"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || strings.Join(records[0].Categories, ",") != "SciFi" {
+		t.Errorf("expected the record to keep [SciFi], got %v", records)
+	}
+}
+
+func TestImplicationsCycle(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.txt")
+	setupTestFile(t, rules, []string{
+		"A -> B",
+		"B -> C",
+		"C -> A",
+	})
+	_, err := Open(filepath.Join(t.TempDir(), ".catodb"), &Options{Implications: rules})
+	if err == nil || !strings.Contains(err.Error(), "A -> B -> C -> A") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+
+	setupTestFile(t, rules, []string{"A B"})
+	if _, err := Open(filepath.Join(t.TempDir(), ".catodb"), &Options{Implications: rules}); err == nil {
+		t.Errorf("expected error for a line without an arrow")
+	}
+}
+
+func TestImplicationsLeaveRecordsAlone(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.txt")
+	setupTestFile(t, rules, []string{"SciFi -> Fiction"})
+	db := openTestDB(t, []string{"/a|Books,SciFi|2023-07-01T00:00:00Z"}, &Options{Implications: rules})
+
+	for i := 0; i < 2; i++ {
+		matched, _, err := db.Partition("", []string{"Fiction"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(matched) != 1 || strings.Join(matched[0].Categories, ",") != "Books,SciFi" {
+			t.Errorf("expected /a with [Books SciFi], got %v", matched)
+		}
+	}
+
+	snap, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		matches, err := snap.Query("", []string{"SciFi"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(matches) != 1 || matches[0] != "/a" {
+			t.Errorf("query %d: expected [/a], got %v", i+1, matches)
+		}
+	}
+}
+
+func TestImplicationsQueryReader(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.txt")
+	setupTestFile(t, rules, []string{"SciFi -> Fiction"})
+
+	stream := strings.NewReader("/path/to/dune|SciFi|2023-07-01T00:00:00Z\n")
+	matches, err := QueryReader(stream, ".*", []string{"Fiction"}, &Options{Implications: rules})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/dune" {
+		t.Errorf("expected [/path/to/dune], got %v", matches)
+	}
+}
@@ -0,0 +1,66 @@
+package catobase
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// includeDirective starts a category file line naming another category
+// file whose lines are read in its place.
+const includeDirective = "@include"
+
+// maxIncludeDepth bounds how deeply category files may include each other.
+const maxIncludeDepth = 8
+
+// includePath returns the file named by an "@include path" line, or "" if
+// line is not one.
+func includePath(line string) string {
+	line = strings.TrimSpace(line)
+	rest, ok := strings.CutPrefix(line, includeDirective)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return ""
+	}
+	return strings.TrimSpace(rest)
+}
+
+// readCategoryLines calls fn for each line of the category file fileName,
+// as ReadFileFunc does, with every "@include path" line replaced by the
+// lines of the file it names. A relative path is resolved against the
+// directory of the including file. Including a file that is already being
+// read, or nesting more than maxIncludeDepth files deep, is an error.
+func readCategoryLines(fileName string, fn func(line string) error) error {
+	var stack []string
+	var read func(fileName string) error
+	read = func(fileName string) error {
+		abs, err := filepath.Abs(fileName)
+		if err != nil {
+			return err
+		}
+		for _, f := range stack {
+			if f == abs {
+				return fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+			}
+		}
+		if len(stack) > maxIncludeDepth {
+			return fmt.Errorf("%s: includes nested more than %d deep", fileName, maxIncludeDepth)
+		}
+		stack = append(stack, abs)
+		defer func() { stack = stack[:len(stack)-1] }()
+
+		return ReadFileFunc(fileName, func(line string) error {
+			if strings.TrimSpace(line) == includeDirective {
+				return fmt.Errorf("%s: %s without a file name", fileName, includeDirective)
+			}
+			included := includePath(line)
+			if included == "" {
+				return fn(line)
+			}
+			if !filepath.IsAbs(included) {
+				included = filepath.Join(filepath.Dir(fileName), included)
+			}
+			return read(included)
+		})
+	}
+	return read(fileName)
+}
@@ -0,0 +1,74 @@
+package catobase
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCategoryFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "shared", "base"), 0755)
+	top := filepath.Join(dir, "top.txt")
+	setupTestFile(t, top, []string{"Books", "@include shared/middle.txt"})
+	setupTestFile(t, filepath.Join(dir, "shared", "middle.txt"), []string{"Music: songs", "@include base/bottom.txt"})
+	setupTestFile(t, filepath.Join(dir, "shared", "base", "bottom.txt"), []string{"Games"})
+
+	categories, err := ListCategoriesWithDescriptions(top)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "Books,Games,Music" || categories["Music"] != "songs" {
+		t.Errorf("expected Books, Games and Music, got %v", categories)
+	}
+
+	// Included categories count when registering the file
+	db := openTestDB(t, nil, nil)
+	if _, err := db.RegisterFile(top, []string{"Books", "Games"}, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCategoryFileIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	setupTestFile(t, a, []string{"Books", "@include b.txt"})
+	setupTestFile(t, filepath.Join(dir, "b.txt"), []string{"@include a.txt"})
+
+	if _, err := ListCategoriesWithDescriptions(a); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+
+	// A chain of distinct files deeper than the limit
+	for i := 0; i <= maxIncludeDepth+1; i++ {
+		name := filepath.Join(dir, "deep"+strings.Repeat("x", i)+".txt")
+		setupTestFile(t, name, []string{"@include deep" + strings.Repeat("x", i+1) + ".txt"})
+	}
+	setupTestFile(t, filepath.Join(dir, "deep"+strings.Repeat("x", maxIncludeDepth+2)+".txt"), []string{"Books"})
+	if _, err := readCategories(filepath.Join(dir, "deep.txt")); err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("expected a depth error, got %v", err)
+	}
+}
+
+func TestNormalizeCategoryFileKeepsIncludes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cats.txt")
+	setupTestFile(t, file, []string{"Music", "@include other.txt", "Books"})
+
+	if _, err := NormalizeCategoryFile(file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(file)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if strings.Join(lines, ",") != "@include other.txt,Books,Music" {
+		t.Errorf("expected the include ahead of the sorted names, got %v", lines)
+	}
+}
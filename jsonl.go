@@ -0,0 +1,79 @@
+package catobase
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportJSONL writes every record to w as newline-delimited JSON, one
+// {"path","categories","registered"} object per line, plus "meta" for
+// records with metadata, in file order.
+func (db *DB) ExportJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return db.scan(func(r Record) error {
+		if r.Categories == nil {
+			r.Categories = []string{}
+		}
+		return enc.Encode(r)
+	})
+}
+
+// ImportJSONL appends the records read from newline-delimited JSON, as
+// written by ExportJSONL, and returns how many were imported. Blank lines are
+// skipped. Nothing is written unless every line is a valid record; the error
+// for the first bad line names its line number.
+func (db *DB) ImportJSONL(r io.Reader) (int, error) {
+	sep, err := db.separator()
+	if err != nil {
+		return 0, err
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return 0, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if rec.Path == "" {
+			return 0, fmt.Errorf("line %d: record has no path", lineNo)
+		}
+		if rec.Path, err = db.storedPathOf(rec.Path); err != nil {
+			return 0, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if err := validatePath(rec.Path, sep); err != nil {
+			return 0, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if err := validateCategories(rec.Categories, sep); err != nil {
+			return 0, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if err := validateMeta(rec.Meta, sep); err != nil {
+			return 0, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		rec.Categories = NewCategorySet(db.normalize(rec.Categories)...).Slice()
+		lines = append(lines, formatRecord(rec, sep))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	err = db.withWriteLock(func() error {
+		return db.appendLines(lines)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(lines), nil
+}
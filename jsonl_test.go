@@ -0,0 +1,63 @@
+package catobase
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONLRoundTrip(t *testing.T) {
+	lines := []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2||2023-07-02T00:00:00Z",
+		"/path/to/file3|Music|2023-07-03T00:00:00Z",
+	}
+	src := openTestDB(t, lines, nil)
+
+	var buf bytes.Buffer
+	if err := src.ExportJSONL(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exported := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(exported) != 3 {
+		t.Fatalf("expected 3 JSON lines, got %q", buf.String())
+	}
+	if exported[0] != `{"path":"/path/to/file1","categories":["Books","Movies"],"registered":"2023-07-01T00:00:00Z"}` {
+		t.Errorf("unexpected first line: %s", exported[0])
+	}
+
+	dst := openTestDB(t, nil, nil)
+	n, err := dst.ImportJSONL(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 records imported, got %d", n)
+	}
+	got, err := readFile(dst.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if strings.Join(got, "\n") != strings.Join(lines, "\n") {
+		t.Errorf("expected %v after round trip, got %v", lines, got)
+	}
+}
+
+func TestImportJSONLReportsLine(t *testing.T) {
+	db := openTestDB(t, []string{}, nil)
+	input := `{"path":"/path/to/file1","categories":["Books"],"registered":"2023-07-01T00:00:00Z"}
+
+{"path":"/path/to/file2","categories":
+`
+	_, err := db.ImportJSONL(strings.NewReader(input))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected error for line 3, got %v", err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("expected nothing imported, got %v", lines)
+	}
+}
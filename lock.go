@@ -0,0 +1,233 @@
+package catobase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrLocked is returned when the database lock is held by someone else.
+var ErrLocked = errors.New("database is locked")
+
+const (
+	defaultLockAttempts = 5
+	defaultLockDelay    = 10 * time.Millisecond
+)
+
+// lockPath returns the lock file guarding the database.
+func (db *DB) lockPath() string {
+	return db.path + ".lock"
+}
+
+// tryLock creates the lock file, or fails with ErrLocked if it already
+// exists. A stale lock is removed first. The file holds our pid and a token
+// unique to this acquisition, which tryLock returns for releaseLock.
+func (db *DB) tryLock() (string, error) {
+	db.removeStaleLock()
+	if err := db.ensureDir(); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(db.lockPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return "", ErrLocked
+		}
+		return "", err
+	}
+	token := fmt.Sprintf("%d %d", os.Getpid(), time.Now().UnixNano())
+	_, err = fmt.Fprintln(f, token)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(db.lockPath())
+		return "", err
+	}
+	return token, nil
+}
+
+// acquireLock takes the lock, retrying with exponential backoff while it is
+// held elsewhere. It gives up with ErrLocked after Options.LockAttempts tries,
+// or with ctx.Err() as soon as ctx is done. It returns the lock's token.
+func (db *DB) acquireLock(ctx context.Context) (string, error) {
+	attempts := db.opts.LockAttempts
+	if attempts <= 0 {
+		attempts = defaultLockAttempts
+	}
+	delay := db.opts.LockDelay
+	if delay <= 0 {
+		delay = defaultLockDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		token, err := db.tryLock()
+		if !errors.Is(err, ErrLocked) {
+			return token, err
+		}
+		if attempt >= attempts {
+			return "", fmt.Errorf("%w: %s", ErrLocked, db.lockPath())
+		}
+
+		db.logger().Debug("waiting for lock", "lock", db.lockPath(), "attempt", attempt, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// removeStaleLock removes the lock file if it is older than
+// Options.StaleLockAge and the process recorded in it is no longer running
+// on this machine. The lock is moved aside before it is removed; should it
+// turn out to be a fresh lock another process took meanwhile, it is put
+// back.
+func (db *DB) removeStaleLock() {
+	if db.opts.StaleLockAge <= 0 {
+		return
+	}
+	info, err := os.Stat(db.lockPath())
+	if err != nil || time.Since(info.ModTime()) < db.opts.StaleLockAge {
+		return
+	}
+	data, err := os.ReadFile(db.lockPath())
+	if err != nil {
+		return
+	}
+	if pid, err := strconv.Atoi(lockPid(string(data))); err == nil && processAlive(pid) {
+		db.logger().Debug("keeping old lock of a running process", "lock", db.lockPath(), "pid", pid)
+		return
+	}
+
+	db.logger().Debug("removing stale lock", "lock", db.lockPath(), "age", time.Since(info.ModTime()))
+	aside := fmt.Sprintf("%s.stale%d", db.lockPath(), time.Now().UnixNano())
+	if err := os.Rename(db.lockPath(), aside); err != nil {
+		return
+	}
+	defer os.Remove(aside)
+	if moved, err := os.ReadFile(aside); err != nil || string(moved) != string(data) {
+		os.Link(aside, db.lockPath())
+	}
+}
+
+// processAlive reports whether a process with the given pid is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// lockPid returns the pid at the start of a lock file's contents.
+func lockPid(data string) string {
+	pid, _, _ := strings.Cut(strings.TrimSpace(data), " ")
+	return pid
+}
+
+// lockHolder returns the pid recorded in the lock file, or "" if it cannot
+// be read.
+func (db *DB) lockHolder() string {
+	data, err := os.ReadFile(db.lockPath())
+	if err != nil {
+		return ""
+	}
+	return lockPid(string(data))
+}
+
+// releaseLock removes the lock file if it still holds token, so a lock
+// taken over as stale is left to its new holder.
+func (db *DB) releaseLock(token string) error {
+	data, err := os.ReadFile(db.lockPath())
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) != token {
+		return fmt.Errorf("lock %s was taken over by process %s", db.lockPath(), lockPid(string(data)))
+	}
+	return os.Remove(db.lockPath())
+}
+
+// AcquireLock takes the database lock for this handle, so a series of
+// operations runs without other processes writing in between. It waits as
+// writes do when Options.Lock is set, retrying with backoff, but returns
+// ctx.Err() as soon as ctx is done, so a deadline bounds the wait. While the
+// lock is held, writes through this handle use it instead of taking it
+// again, whatever Options.Lock says. Release it with ReleaseLock.
+func (db *DB) AcquireLock(ctx context.Context) error {
+	if db.held.Load() {
+		return errors.New("lock is already held by this handle")
+	}
+	token, err := db.acquireLock(ctx)
+	if err != nil {
+		return err
+	}
+	db.heldToken = token
+	db.held.Store(true)
+	return nil
+}
+
+// ReleaseLock releases the lock taken by AcquireLock.
+func (db *DB) ReleaseLock() error {
+	if !db.held.Load() {
+		return errors.New("lock is not held by this handle")
+	}
+	// Let a write in progress finish under the lock first
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	db.held.Store(false)
+	return db.releaseLock(db.heldToken)
+}
+
+// withWriteLock runs fn with writes through this handle serialized and, when
+// Options.Lock is set, the database lock held.
+func (db *DB) withWriteLock(fn func() error) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	if !db.opts.Lock || db.held.Load() {
+		return db.claimStaged(fn)
+	}
+	token, err := db.acquireLock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer db.releaseLock(token)
+	return db.claimStaged(fn)
+}
+
+// withBulkLock runs fn, a bulk operation, like withWriteLock. When
+// Options.BulkLock is set the database lock is held throughout but tried
+// only once: if another process holds it, withBulkLock fails with ErrLocked
+// instead of waiting.
+func (db *DB) withBulkLock(fn func() error) error {
+	if !db.opts.BulkLock || db.held.Load() {
+		return db.withWriteLock(fn)
+	}
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	token, err := db.tryLock()
+	if err != nil {
+		if errors.Is(err, ErrLocked) {
+			if pid := db.lockHolder(); pid != "" {
+				return fmt.Errorf("%w: %s is held by process %s", ErrLocked, db.lockPath(), pid)
+			}
+			return fmt.Errorf("%w: %s", ErrLocked, db.lockPath())
+		}
+		return err
+	}
+	defer db.releaseLock(token)
+	return db.claimStaged(fn)
+}
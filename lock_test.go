@@ -0,0 +1,193 @@
+package catobase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockRetriesUntilReleased(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, []string{}, &Options{Lock: true, LockAttempts: 10, LockDelay: 5 * time.Millisecond})
+
+	// Simulate another process holding the lock for a while
+	setupTestFile(t, db.lockPath(), []string{"12345"})
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		os.Remove(db.lockPath())
+	}()
+
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(db.lockPath()); !os.IsNotExist(err) {
+		t.Errorf("expected lock to be released after the write, got %v", err)
+	}
+}
+
+func TestLockGivesUp(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, []string{}, &Options{Lock: true, LockAttempts: 3, LockDelay: time.Millisecond})
+	setupTestFile(t, db.lockPath(), []string{"12345"})
+
+	_, err := db.RegisterFile(testFile, []string{"Books"}, false)
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("expected nothing to be written, got %v", lines)
+	}
+}
+
+func TestLockRespectsContext(t *testing.T) {
+	db := openTestDB(t, []string{}, &Options{Lock: true, LockAttempts: 1000, LockDelay: time.Millisecond})
+	setupTestFile(t, db.lockPath(), []string{"12345"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := db.acquireLock(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected to give up near the deadline, took %v", elapsed)
+	}
+}
+
+func TestBulkLockFailsFast(t *testing.T) {
+	folder := t.TempDir()
+	setupTestFile(t, filepath.Join(folder, "file1.txt"), []string{"Books"})
+	db := openTestDB(t, []string{}, &Options{BulkLock: true, Lock: true, LockAttempts: 1000, LockDelay: time.Hour})
+
+	// Another bulk run over the same database holds the lock
+	other, err := Open(db.Path(), nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	token, err := other.tryLock()
+	if err != nil {
+		t.Fatalf("failed to take the lock: %v", err)
+	}
+
+	start := time.Now()
+	_, err = db.RegisterFolder(folder, `\.txt$`, nil)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected the bulk operation to fail without waiting")
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("process %d", os.Getpid())) {
+		t.Errorf("expected the error to name the holder, got %v", err)
+	}
+
+	other.releaseLock(token)
+	files, err := db.RegisterFolder(folder, `\.txt$`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected 1 registered file, got %v", files)
+	}
+	if _, err := os.Stat(db.lockPath()); !os.IsNotExist(err) {
+		t.Errorf("expected lock to be released after the bulk operation")
+	}
+}
+
+func TestStaleLockIsRemoved(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, []string{}, &Options{Lock: true, LockAttempts: 1, StaleLockAge: time.Minute})
+
+	// No process runs with this pid
+	setupTestFile(t, db.lockPath(), []string{"999999999 1"})
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(db.lockPath(), old, old)
+
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("expected the stale lock to be taken over: %v", err)
+	}
+	if _, err := os.Stat(db.lockPath()); !os.IsNotExist(err) {
+		t.Errorf("expected lock to be released after the write, got %v", err)
+	}
+}
+
+func TestOldLockOfRunningProcessIsKept(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, []string{}, &Options{Lock: true, LockAttempts: 1, StaleLockAge: time.Minute})
+
+	setupTestFile(t, db.lockPath(), []string{fmt.Sprintf("%d 1", os.Getpid())})
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(db.lockPath(), old, old)
+
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked while the holder runs, got %v", err)
+	}
+}
+
+func TestReleaseLockLeavesOthersLock(t *testing.T) {
+	db := openTestDB(t, []string{}, nil)
+	if err := db.AcquireLock(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The lock was taken over as stale while this handle held it
+	setupTestFile(t, db.lockPath(), []string{"12345 1"})
+	if err := db.ReleaseLock(); err == nil {
+		t.Errorf("expected an error releasing a lock taken over")
+	}
+	if holder := db.lockHolder(); holder != "12345" {
+		t.Errorf("expected the new holder's lock to be kept, got holder %q", holder)
+	}
+}
+
+func TestAcquireLockDeadline(t *testing.T) {
+	db := openTestDB(t, []string{}, &Options{LockAttempts: 1000, LockDelay: time.Millisecond})
+	setupTestFile(t, db.lockPath(), []string{"12345"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := db.AcquireLock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected to give up near the deadline, took %v", elapsed)
+	}
+}
+
+func TestAcquireLockCoversWrites(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, []string{}, &Options{Lock: true, LockAttempts: 1})
+
+	if err := db.AcquireLock(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Writes through the handle holding the lock do not wait for it
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(db.lockPath()); err != nil {
+		t.Errorf("expected the lock to be held until released: %v", err)
+	}
+	if err := db.ReleaseLock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(db.lockPath()); !os.IsNotExist(err) {
+		t.Errorf("expected the lock to be released")
+	}
+}
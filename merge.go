@@ -0,0 +1,127 @@
+package catobase
+
+import (
+	"fmt"
+	"iter"
+)
+
+// mergeSource is one database read by MergeSorted, positioned on its next
+// record.
+type mergeSource struct {
+	name string
+	next func() (Record, bool)
+	stop func()
+	err  error // why reading stopped early
+	head Record
+	ok   bool // head holds a record
+}
+
+// openMergeSource opens the database at name for a streaming read.
+func openMergeSource(name string) (*mergeSource, error) {
+	db, err := Open(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	src := &mergeSource{name: name}
+	src.next, src.stop = iter.Pull(iter.Seq[Record](func(yield func(Record) bool) {
+		src.err = db.scan(func(r Record) error {
+			if !yield(r) {
+				return ErrStop
+			}
+			return nil
+		})
+	}))
+	return src, src.advance()
+}
+
+// advance moves to the next record, failing if the source turns out not to
+// be sorted by path.
+func (s *mergeSource) advance() error {
+	prev, hadPrev := s.head, s.ok
+	s.head, s.ok = s.next()
+	if s.err != nil {
+		return fmt.Errorf("failed to read %s: %w", s.name, s.err)
+	}
+	if s.ok && hadPrev && s.head.Path < prev.Path {
+		return fmt.Errorf("%s is not sorted by path: %q follows %q; run Canonicalize on it first", s.name, s.head.Path, prev.Path)
+	}
+	return nil
+}
+
+// MergeSorted writes the records of the databases srcs into the database at
+// dst, replacing its contents, with each path kept once, by its newest
+// record; on a tie the record from the later source wins.
+//
+// Every source must be sorted by path, as Canonicalize leaves it: the
+// sources are merged as streams, holding one record of each in memory, so
+// MergeSorted can combine databases too large to load. A source found out
+// of order fails the merge and leaves dst untouched. dst itself may be
+// among the sources.
+//
+// Records are written with the separator of dst, keeping its header if it
+// has one. A record that separator cannot hold, such as a path containing
+// it, fails the merge too.
+func MergeSorted(dst string, srcs ...string) error {
+	out, err := Open(dst, nil)
+	if err != nil {
+		return err
+	}
+	sources := make([]*mergeSource, 0, len(srcs))
+	defer func() {
+		for _, s := range sources {
+			s.stop()
+		}
+	}()
+	for _, name := range srcs {
+		s, err := openMergeSource(name)
+		if s != nil {
+			sources = append(sources, s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return out.withWriteLock(func() error {
+		h, hasHeader, err := out.readHeader()
+		if err != nil {
+			return err
+		}
+		sep := out.opts.Separator
+		if hasHeader {
+			sep = h.sep
+		}
+		return out.writeLines(func(emit func(line string)) error {
+			if hasHeader {
+				emit(h.String())
+			}
+			for {
+				// The smallest path among the sources, and its newest record
+				var best *Record
+				for _, s := range sources {
+					if s.ok && (best == nil || s.head.Path < best.Path) {
+						best = &s.head
+					}
+				}
+				if best == nil {
+					return nil
+				}
+				path, newest := best.Path, *best
+				for _, s := range sources {
+					for s.ok && s.head.Path == path {
+						if !s.head.Registered.Before(newest.Registered) {
+							newest = s.head
+						}
+						if err := s.advance(); err != nil {
+							return err
+						}
+					}
+				}
+				if err := validateRecord(newest, sep); err != nil {
+					return err
+				}
+				emit(formatRecord(newest, sep))
+			}
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package catobase
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeSorted(t *testing.T) {
+	dir := t.TempDir()
+	srcs := []string{filepath.Join(dir, "a.catodb"), filepath.Join(dir, "b.catodb"), filepath.Join(dir, "c.catodb")}
+	setupTestFile(t, srcs[0], []string{
+		"/path/a|Books|2023-07-01T00:00:00Z",
+		"/path/c|Books|2023-07-01T00:00:00Z",
+		"/path/e|Books|2023-07-01T00:00:00Z",
+	})
+	setupTestFile(t, srcs[1], []string{
+		"/path/b|Music|2023-07-01T00:00:00Z",
+		"/path/c|Music|2023-07-03T00:00:00Z",
+	})
+	setupTestFile(t, srcs[2], []string{
+		"/path/c|Games|2023-07-02T00:00:00Z",
+		"/path/d|Games|2023-07-01T00:00:00Z",
+		"/path/e|Games|2023-07-01T00:00:00Z",
+	})
+
+	dst := filepath.Join(dir, "merged.catodb")
+	if err := MergeSorted(dst, srcs...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	expected := []string{
+		"/path/a|Books|2023-07-01T00:00:00Z",
+		"/path/b|Music|2023-07-01T00:00:00Z",
+		"/path/c|Music|2023-07-03T00:00:00Z",
+		"/path/d|Games|2023-07-01T00:00:00Z",
+		"/path/e|Games|2023-07-01T00:00:00Z",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+
+	// An unsorted source fails the merge and leaves dst alone
+	setupTestFile(t, srcs[1], []string{
+		"/path/z|Music|2023-07-01T00:00:00Z",
+		"/path/b|Music|2023-07-01T00:00:00Z",
+	})
+	if err := MergeSorted(dst, srcs...); err == nil || !strings.Contains(err.Error(), "not sorted") {
+		t.Errorf("expected an unsorted source error, got %v", err)
+	}
+	after, err := readFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if strings.Join(after, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected dst to be untouched, got %v", after)
+	}
+}
+
+func TestMergeSortedSeparators(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.catodb")
+	setupTestFile(t, src, []string{
+		"#catobase v1 sep=#",
+		"/a|b#Books#2023-07-01T00:00:00Z",
+	})
+
+	// The path cannot be written with dst's "|"
+	dst := filepath.Join(dir, "dst.catodb")
+	setupTestFile(t, dst, []string{"/z|Music|2023-07-01T00:00:00Z"})
+	if err := MergeSorted(dst, src); err == nil {
+		t.Errorf("expected error for a path containing the output separator")
+	}
+	if lines, _ := readFile(dst); len(lines) != 1 || lines[0] != "/z|Music|2023-07-01T00:00:00Z" {
+		t.Errorf("expected dst to be untouched, got %v", lines)
+	}
+
+	// A dst headed "sep=;" keeps its header and separator
+	setupTestFile(t, dst, []string{"#catobase v1 sep=;", "/z;Music;2023-07-01T00:00:00Z"})
+	if err := MergeSorted(dst, src, dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(dst)
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	expected := []string{
+		"#catobase v1 sep=;",
+		"/a|b;Books;2023-07-01T00:00:00Z",
+		"/z;Music;2023-07-01T00:00:00Z",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
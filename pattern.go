@@ -0,0 +1,62 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+)
+
+// PatternError reports a regular expression that does not compile. Its
+// message is meant for end users; Unwrap returns the original regexp error.
+type PatternError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	reason := e.Err.Error()
+	var serr *syntax.Error
+	if errors.As(e.Err, &serr) {
+		reason = string(serr.Code)
+		if serr.Expr != "" && serr.Expr != e.Pattern {
+			reason += " in " + serr.Expr
+		}
+	}
+	return fmt.Sprintf("invalid pattern %q: %s", e.Pattern, reason)
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// ValidatePattern reports whether pattern is a valid regular expression,
+// returning a *PatternError if it is not.
+func ValidatePattern(pattern string) error {
+	_, err := compilePattern(pattern)
+	return err
+}
+
+// compilePattern compiles a user-supplied pattern, wrapping failures in a
+// *PatternError.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &PatternError{Pattern: pattern, Err: err}
+	}
+	return re, nil
+}
+
+// compilePathPattern compiles the path pattern of a query, quoting it first
+// when Options.Literal is set and matching case-insensitively when
+// Options.IgnorePathCase is.
+func (db *DB) compilePathPattern(pattern string) (*regexp.Regexp, error) {
+	if db.opts.Literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	re, err := compilePattern(pattern)
+	if err != nil || !db.opts.IgnorePathCase {
+		return re, err
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
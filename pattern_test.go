@@ -0,0 +1,63 @@
+package catobase
+
+import (
+	"errors"
+	"regexp/syntax"
+	"testing"
+)
+
+func TestValidatePattern(t *testing.T) {
+	if err := ValidatePattern("file.*\\.txt"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := ValidatePattern("[")
+	if err == nil {
+		t.Fatalf("expected error for an invalid pattern")
+	}
+	if err.Error() != `invalid pattern "[": missing closing ]` {
+		t.Errorf("unexpected message: %v", err)
+	}
+	var serr *syntax.Error
+	if !errors.As(errors.Unwrap(err), &serr) || serr.Code != syntax.ErrMissingBracket {
+		t.Errorf("expected the regexp error to be wrapped, got %v", errors.Unwrap(err))
+	}
+}
+
+func TestQueriesReturnPatternError(t *testing.T) {
+	db := openTestDB(t, []string{"/path/to/file1|Books|2023-07-01T00:00:00Z"}, nil)
+
+	var perr *PatternError
+	if _, err := db.Get("(", nil); !errors.As(err, &perr) {
+		t.Errorf("expected a PatternError from Get, got %v", err)
+	}
+	if _, err := db.QueryCategoryPattern(".*", "*"); !errors.As(err, &perr) {
+		t.Errorf("expected a PatternError from QueryCategoryPattern, got %v", err)
+	}
+}
+
+func TestLiteralPathPattern(t *testing.T) {
+	lines := []string{
+		"/path/to/report(1).txt|Books|2023-07-01T00:00:00Z",
+		"/path/to/report1xtxt|Books|2023-07-01T00:00:00Z",
+	}
+
+	db := openTestDB(t, lines, &Options{Literal: true})
+	matches, err := db.Get("report(1).txt", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/report(1).txt" {
+		t.Errorf("expected only the literal match, got %v", matches)
+	}
+
+	// As a regexp the same query matches the other file instead
+	db = openTestDB(t, lines, nil)
+	matches, err = db.Get("report(1).txt", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/report1xtxt" {
+		t.Errorf("expected the regexp match, got %v", matches)
+	}
+}
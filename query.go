@@ -0,0 +1,526 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// matchPaths returns the paths of records whose path matches regex and for
+// which match reports true. Each path is returned once, at the position of
+// its first matching record.
+func (db *DB) matchPaths(regex string, match func(r Record) bool) ([]string, error) {
+	return db.matchPathsLimit(regex, 0, match)
+}
+
+// matchPathsLimit is matchPaths stopping the scan once limit paths are
+// found. A limit of zero or less means no limit.
+func (db *DB) matchPathsLimit(regex string, limit int, match func(r Record) bool) ([]string, error) {
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return nil, err
+	}
+	return db.collectPaths(db.scan, re, match, limit)
+}
+
+// collectPaths gathers matching paths, as matchPathsLimit does, from the
+// records produced by each. Paths are told apart by pathKey.
+func (db *DB) collectPaths(each func(fn func(r Record) error) error, re *regexp.Regexp, match func(r Record) bool, limit int) ([]string, error) {
+	var matches []string
+	seen := make(map[string]struct{})
+	err := each(func(r Record) error {
+		key := db.pathKey(r.Path)
+		if _, ok := seen[key]; ok {
+			return nil
+		}
+		if re.MatchString(r.Path) && match(r) {
+			seen[key] = struct{}{}
+			matches = append(matches, r.Path)
+			if limit > 0 && len(matches) >= limit {
+				return ErrStop
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// QueryCategoryPattern returns the paths matching regex that carry at least
+// one category matching categoryPattern. Both patterns are unanchored; use
+// ^ and $ to match a whole category.
+func (db *DB) QueryCategoryPattern(regex string, categoryPattern string) ([]string, error) {
+	cre, err := compilePattern(categoryPattern)
+	if err != nil {
+		return nil, err
+	}
+	return db.matchPaths(regex, func(r Record) bool {
+		for _, c := range r.Categories {
+			if cre.MatchString(c) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// IsRegistered reports whether the database holds a record for exactly path.
+func (db *DB) IsRegistered(path string) (bool, error) {
+	found := false
+	key := db.lookupKey(path)
+	err := db.scan(func(r Record) error {
+		if db.pathKey(r.Path) == key {
+			found = true
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// Since returns the records registered strictly after t, oldest first.
+// Records whose timestamp does not parse are left out.
+func (db *DB) Since(t time.Time) ([]Record, error) {
+	var records []Record
+	err := db.scan(func(r Record) error {
+		if r.Registered.After(t) {
+			records = append(records, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Registered.Before(records[j].Registered)
+	})
+	return records, nil
+}
+
+// ErrNotRegistered is returned when an operation needs a record for a path
+// that has none.
+var ErrNotRegistered = errors.New("path is not registered")
+
+// latestRecords returns the last record of every path, in the order the
+// paths first appear.
+func (db *DB) latestRecords() ([]Record, error) {
+	return db.latest(func(Record) bool { return true })
+}
+
+// latest is latestRecords restricted to the records keep accepts.
+func (db *DB) latest(keep func(r Record) bool) ([]Record, error) {
+	var records []Record
+	index := make(map[string]int)
+	err := db.scan(func(r Record) error {
+		if !keep(r) {
+			return nil
+		}
+		key := db.pathKey(r.Path)
+		if i, ok := index[key]; ok {
+			records[i] = r
+			return nil
+		}
+		index[key] = len(records)
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Related returns the other registered files sharing at least minShared
+// categories with path, most shared first and then by path. Each path is
+// compared using its latest record.
+func (db *DB) Related(path string, minShared int) ([]Record, error) {
+	if minShared < 1 {
+		minShared = 1
+	}
+	records, err := db.latestRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	key := db.lookupKey(path)
+	var target CategorySet
+	for _, r := range records {
+		if db.pathKey(r.Path) == key {
+			target = NewCategorySet(r.Categories...)
+		}
+	}
+	if target == nil {
+		return nil, ErrNotRegistered
+	}
+
+	var related []Record
+	shared := make(map[string]int)
+	for _, r := range records {
+		if db.pathKey(r.Path) == key {
+			continue
+		}
+		n := 0
+		for _, c := range NewCategorySet(r.Categories...).Slice() {
+			if target.Has(c) {
+				n++
+			}
+		}
+		if n >= minShared {
+			shared[r.Path] = n
+			related = append(related, r)
+		}
+	}
+	sort.Slice(related, func(i, j int) bool {
+		a, b := related[i], related[j]
+		if shared[a.Path] != shared[b.Path] {
+			return shared[a.Path] > shared[b.Path]
+		}
+		return a.Path < b.Path
+	})
+	return related, nil
+}
+
+// GetPaths returns the latest record of each of paths in a single scan, in
+// the order the paths first appear in the database. Paths without a record
+// are left out.
+func (db *DB) GetPaths(paths []string) ([]Record, error) {
+	wanted := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		wanted[db.lookupKey(p)] = struct{}{}
+	}
+	return db.latest(func(r Record) bool {
+		_, ok := wanted[db.pathKey(r.Path)]
+		return ok
+	})
+}
+
+// Untagged returns the paths whose latest record has no categories, or only
+// blank ones, in the order the paths first appear.
+func (db *DB) Untagged() ([]string, error) {
+	records, err := db.latestRecords()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, r := range records {
+		if strings.TrimSpace(strings.Join(r.Categories, "")) == "" {
+			paths = append(paths, r.Path)
+		}
+	}
+	return paths, nil
+}
+
+// FileCount reports, in one scan, the number of distinct registered paths
+// and the total number of records. The difference is the records that only
+// repeat a path.
+func (db *DB) FileCount() (distinct int, total int, err error) {
+	paths := make(map[string]struct{})
+	err = db.scan(func(r Record) error {
+		paths[db.pathKey(r.Path)] = struct{}{}
+		total++
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(paths), total, nil
+}
+
+// ValidateAgainst returns, sorted, the categories used by any record that
+// are not listed in the category file masterFile. An empty result means every
+// category in the database is known.
+func (db *DB) ValidateAgainst(masterFile string) ([]string, error) {
+	names, err := readCategories(masterFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", masterFile, err)
+	}
+	master := NewCategorySet(db.normalize(names)...)
+
+	unknown := NewCategorySet()
+	err = db.scan(func(r Record) error {
+		for _, c := range r.Categories {
+			if !master.Has(c) {
+				unknown.Add(c)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unknown.Slice(), nil
+}
+
+// isLatest reports whether the latest record of path, buffered or written,
+// carries exactly categories, in any order. A missing database has no
+// records. The caller holds the write lock.
+func (db *DB) isLatest(path string, categories []string) (bool, error) {
+	want := NewCategorySet(db.normalize(categories)...)
+	if r, ok := db.bufferedRecord(path); ok {
+		have := NewCategorySet(r.Categories...)
+		return have.Len() == want.Len() && have.HasAll(want.Slice()), nil
+	}
+
+	records, err := db.GetPaths([]string{path})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if len(records) == 0 {
+		return false, nil
+	}
+	have := NewCategorySet(records[0].Categories...)
+	return have.Len() == want.Len() && have.HasAll(want.Slice()), nil
+}
+
+// CategoryDiff compares the categories listed in the file at path with its
+// latest record and returns, sorted, those the file has gained since it was
+// registered and those it has lost. It returns ErrNotRegistered if path has
+// no record.
+func (db *DB) CategoryDiff(path string) (added, removed []string, err error) {
+	names, err := readCategories(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	records, err := db.GetPaths([]string{path})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, ErrNotRegistered
+	}
+
+	current := NewCategorySet(db.normalize(names)...)
+	stored := NewCategorySet(records[0].Categories...)
+	for _, c := range current.Slice() {
+		if !stored.Has(c) {
+			added = append(added, c)
+		}
+	}
+	for _, c := range stored.Slice() {
+		if !current.Has(c) {
+			removed = append(removed, c)
+		}
+	}
+	return added, removed, nil
+}
+
+// UnusedCategories returns the categories listed in the category file
+// masterFile that no record uses, in the order the file lists them. It is the
+// converse of ValidateAgainst.
+func (db *DB) UnusedCategories(masterFile string) ([]string, error) {
+	names, err := readCategories(masterFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", masterFile, err)
+	}
+
+	used := NewCategorySet()
+	err = db.scan(func(r Record) error {
+		used.Add(r.Categories...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var unused []string
+	listed := NewCategorySet()
+	for _, name := range db.normalize(names) {
+		if !used.Has(name) && !listed.Has(name) {
+			unused = append(unused, name)
+		}
+		listed.Add(name)
+	}
+	return unused, nil
+}
+
+// GetByMeta returns the paths matching regex whose record has the metadata
+// value under key, with the same rules as Get otherwise.
+func (db *DB) GetByMeta(regex string, key, value string) ([]string, error) {
+	return db.matchPaths(regex, func(r Record) bool {
+		v, ok := r.MetaValue(key)
+		return ok && v == value
+	})
+}
+
+// GetExactCategories returns, for each path matching regex, its latest record
+// if its categories are exactly categories, in any order: records carrying
+// more or fewer categories do not match, and neither do older records.
+func (db *DB) GetExactCategories(regex string, categories []string) ([]Record, error) {
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return nil, err
+	}
+	want := NewCategorySet(db.normalize(categories)...)
+	records, err := db.latest(func(r Record) bool {
+		return re.MatchString(r.Path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	kept := records[:0]
+	for _, r := range records {
+		have := NewCategorySet(r.Categories...)
+		if have.Len() == want.Len() && have.HasAll(want.Slice()) {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// GetByCategoryCount returns, for each path matching regex, its latest record
+// if it carries at least min and at most max distinct categories. A max of
+// zero means no upper bound.
+func (db *DB) GetByCategoryCount(regex string, min, max int) ([]Record, error) {
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return nil, err
+	}
+	records, err := db.latest(func(r Record) bool {
+		return re.MatchString(r.Path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	kept := records[:0]
+	for _, r := range records {
+		n := NewCategorySet(r.Categories...).Len()
+		if n >= min && (max <= 0 || n <= max) {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// GetCategorySubstring returns, for each path matching regex, its latest
+// record if it has a category that contains sub, so "proj" finds
+// "project-x".
+func (db *DB) GetCategorySubstring(regex string, sub string) ([]Record, error) {
+	return db.categorySubstring(regex, sub, strings.Contains)
+}
+
+// GetCategorySubstringFold is GetCategorySubstring ignoring letter case.
+func (db *DB) GetCategorySubstringFold(regex string, sub string) ([]Record, error) {
+	return db.categorySubstring(regex, strings.ToLower(sub), func(c, sub string) bool {
+		return strings.Contains(strings.ToLower(c), sub)
+	})
+}
+
+// categorySubstring does the work of GetCategorySubstring, testing each
+// category with contains.
+func (db *DB) categorySubstring(regex string, sub string, contains func(c, sub string) bool) ([]Record, error) {
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return nil, err
+	}
+	records, err := db.latest(func(r Record) bool {
+		return re.MatchString(r.Path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	kept := records[:0]
+	for _, r := range records {
+		for _, c := range r.Categories {
+			if contains(c, sub) {
+				kept = append(kept, r)
+				break
+			}
+		}
+	}
+	return kept, nil
+}
+
+// GetUnderPrefix returns, for each path in the directory prefix or below it,
+// its latest record if its categories include all of categories. The prefix
+// is matched on whole path elements, so "/proj" matches "/proj/a" but not
+// "/projects/a".
+func (db *DB) GetUnderPrefix(prefix string, categories []string) ([]Record, error) {
+	dir := db.lookupKey(filepath.Clean(prefix))
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	categories = db.normalize(categories)
+	records, err := db.latest(func(r Record) bool {
+		key := db.pathKey(r.Path)
+		return key+string(filepath.Separator) == dir || strings.HasPrefix(key, dir)
+	})
+	if err != nil {
+		return nil, err
+	}
+	kept := records[:0]
+	for _, r := range records {
+		if db.expand(r.Categories).HasAll(categories) {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// Partition splits the latest record of every path in a single scan: those
+// whose path matches regex and whose categories include all of categories,
+// and the rest. Every path is in exactly one of the two. Unlike Get, which
+// matches a path if any of its records does, Partition judges each path by
+// its latest record alone.
+func (db *DB) Partition(regex string, categories []string) (matched, unmatched []Record, err error) {
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return nil, nil, err
+	}
+	categories = db.normalize(categories)
+	records, err := db.latestRecords()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range records {
+		if re.MatchString(r.Path) && db.expand(r.Categories).HasAll(categories) {
+			matched = append(matched, r)
+		} else {
+			unmatched = append(unmatched, r)
+		}
+	}
+	return matched, unmatched, nil
+}
+
+// NumberedRecord is a database line as returned by AllWithLines.
+type NumberedRecord struct {
+	Line   int    // 1-based line number in the database file
+	Record Record // zero if Malformed
+	// Malformed is set for a line that does not parse as a record; Text
+	// then holds the line.
+	Malformed bool
+	Text      string
+}
+
+// AllWithLines returns every record with its line number, in file order,
+// for tools that edit the database in place. Lines that do not parse are
+// included as Malformed; the header line is left out.
+func (db *DB) AllWithLines() ([]NumberedRecord, error) {
+	var all []NumberedRecord
+	err := db.scanLines(func(l rawLine) error {
+		switch {
+		case l.header, l.footer:
+		case l.err != nil:
+			all = append(all, NumberedRecord{Line: l.no, Malformed: true, Text: l.text})
+		default:
+			all = append(all, NumberedRecord{Line: l.no, Record: l.rec})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
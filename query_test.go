@@ -0,0 +1,627 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryCategoryPattern(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,proj-alpha|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|proj-beta|2023-07-01T00:00:00Z",
+		"/path/to/file4|myproj-gamma|2023-07-01T00:00:00Z",
+	}, nil)
+
+	matches, err := db.QueryCategoryPattern(".*", "^proj-.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"/path/to/file1", "/path/to/file3"}
+	if strings.Join(matches, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected matches %v, got %v", expected, matches)
+	}
+
+	// The path regex still applies
+	matches, err = db.QueryCategoryPattern("file3", "proj-.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/file3" {
+		t.Errorf("expected /path/to/file3, got %v", matches)
+	}
+
+	if _, err := db.QueryCategoryPattern(".*", "["); err == nil {
+		t.Errorf("expected error for an invalid category pattern")
+	}
+}
+
+func TestIsRegistered(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file10|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	cases := map[string]bool{
+		"/path/to/file1":  true,
+		"/path/to/file10": true,
+		"/path/to/file":   false,
+		"/path/to/file2":  false,
+	}
+	for path, expected := range cases {
+		got, err := db.IsRegistered(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != expected {
+			t.Errorf("IsRegistered(%q) = %v, expected %v", path, got, expected)
+		}
+	}
+}
+
+func TestSince(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-03T00:00:00Z",
+		"/path/to/file2|Books|2023-07-01T00:00:00Z",
+		"/path/to/file3|Books|2023-07-02T00:00:00Z",
+		"/path/to/file4|Books|2023-07-04T00:00:00Z",
+		"/path/to/file5|Books|not-a-time",
+	}, nil)
+
+	since, _ := time.Parse(time.RFC3339, "2023-07-02T00:00:00Z")
+	records, err := db.Since(since)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var paths []string
+	for _, r := range records {
+		paths = append(paths, r.Path)
+	}
+	expected := []string{"/path/to/file1", "/path/to/file4"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestRelated(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/target|Books,Movies,Music|2023-07-01T00:00:00Z",
+		"/path/to/one|Books,Games|2023-07-01T00:00:00Z",
+		"/path/to/three|Books,Movies,Music,Games|2023-07-01T00:00:00Z",
+		"/path/to/two|Movies,Music|2023-07-01T00:00:00Z",
+		"/path/to/none|Games|2023-07-01T00:00:00Z",
+		"/path/to/also-two|Books,Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	related, err := db.Related("/path/to/target", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, r := range related {
+		paths = append(paths, r.Path)
+	}
+	expected := []string{"/path/to/three", "/path/to/also-two", "/path/to/two", "/path/to/one"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	related, err = db.Related("/path/to/target", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(related) != 1 || related[0].Path != "/path/to/three" {
+		t.Errorf("expected only /path/to/three with minShared 3, got %v", related)
+	}
+
+	if _, err := db.Related("/path/to/missing", 1); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+}
+
+func TestGetPaths(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|Games|2023-07-01T00:00:00Z",
+		"/path/to/file1|Books,Movies|2023-07-02T00:00:00Z",
+	}, nil)
+
+	records, err := db.GetPaths([]string{"/path/to/file3", "/path/to/missing", "/path/to/file1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %v", records)
+	}
+	if records[0].Path != "/path/to/file1" || strings.Join(records[0].Categories, ",") != "Books,Movies" {
+		t.Errorf("expected the latest record of /path/to/file1 first, got %v", records[0])
+	}
+	if records[1].Path != "/path/to/file3" {
+		t.Errorf("expected /path/to/file3 second, got %v", records[1])
+	}
+}
+
+func TestUntagged(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2||2023-07-01T00:00:00Z",
+		"/path/to/file3| |2023-07-01T00:00:00Z",
+		"/path/to/file4||2023-07-01T00:00:00Z",
+		"/path/to/file4|Music|2023-07-02T00:00:00Z",
+	}, nil)
+
+	paths, err := db.Untagged()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"/path/to/file2", "/path/to/file3"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestFileCount(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file1|Books,Movies|2023-07-02T00:00:00Z",
+		"/path/to/file1|Movies|2023-07-03T00:00:00Z",
+	}, nil)
+
+	distinct, total, err := db.FileCount()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if distinct != 2 {
+		t.Errorf("expected 2 distinct files, got %d", distinct)
+	}
+	if total != 4 {
+		t.Errorf("expected 4 records, got %d", total)
+	}
+}
+
+func TestIgnorePathCase(t *testing.T) {
+	lines := []string{`C:\Docs\A.txt|Books|2023-07-01T00:00:00Z`}
+
+	db := openTestDB(t, lines, nil)
+	if ok, _ := db.IsRegistered(`c:\docs\a.txt`); ok {
+		t.Errorf("expected paths to be case-sensitive by default")
+	}
+
+	db = openTestDB(t, lines, &Options{IgnorePathCase: true, Literal: true})
+	ok, err := db.IsRegistered(`c:\docs\a.txt`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Errorf("expected a case-differing path to be registered")
+	}
+	matches, err := db.Get(`c:\docs\a.txt`, []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != `C:\Docs\A.txt` {
+		t.Errorf("expected the stored spelling to match, got %v", matches)
+	}
+
+	db = openTestDB(t, []string{
+		"/A|Books|2023-07-01T00:00:00Z",
+		"/a|Books|2023-07-02T00:00:00Z",
+	}, &Options{IgnorePathCase: true})
+	matches, err = db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected case-differing records to be one path, got %v", matches)
+	}
+}
+
+func TestValidateAgainst(t *testing.T) {
+	master := filepath.Join(t.TempDir(), "categories.txt")
+	setupTestFile(t, master, []string{"Books", "Movies", "Music"})
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music,Moveis|2023-07-01T00:00:00Z",
+	}, nil)
+
+	unknown, err := db.ValidateAgainst(master)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(unknown) != 1 || unknown[0] != "Moveis" {
+		t.Errorf("expected [Moveis], got %v", unknown)
+	}
+}
+
+// countingFile counts the bytes read from the database.
+type countingFile struct {
+	storageFile
+	read *int
+}
+
+func (f countingFile) Read(p []byte) (int, error) {
+	n, err := f.storageFile.Read(p)
+	*f.read += n
+	return n, err
+}
+
+func TestGetLimitStopsEarly(t *testing.T) {
+	lines := make([]string, 10000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("/path/to/file%d|Books|2023-07-01T00:00:00Z", i)
+	}
+	db := openTestDB(t, lines, nil)
+	read := 0
+	db.openFile = func(name string, flag int, perm os.FileMode) (storageFile, error) {
+		f, err := openOSFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return countingFile{storageFile: f, read: &read}, nil
+	}
+
+	matches, err := db.GetLimit(".*", []string{"Books"}, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"/path/to/file0", "/path/to/file1", "/path/to/file2", "/path/to/file3", "/path/to/file4"}
+	if strings.Join(matches, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, matches)
+	}
+	info, err := os.Stat(db.Path())
+	if err != nil {
+		t.Fatalf("failed to stat db: %v", err)
+	}
+	if int64(read) >= info.Size()/10 {
+		t.Errorf("expected the scan to stop early, read %d of %d bytes", read, info.Size())
+	}
+
+	// Without a limit every match is returned
+	matches, err = db.GetLimit(".*", []string{"Books"}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != len(lines) {
+		t.Errorf("expected %d matches, got %d", len(lines), len(matches))
+	}
+}
+
+func TestUnusedCategories(t *testing.T) {
+	master := filepath.Join(t.TempDir(), "categories.txt")
+	setupTestFile(t, master, []string{"Books", "Movies", "Music", "Games"})
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books|2023-07-01T00:00:00Z",
+	}, nil)
+
+	unused, err := db.UnusedCategories(master)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(unused, ",") != "Music,Games" {
+		t.Errorf("expected [Music Games], got %v", unused)
+	}
+}
+
+func TestGetByMeta(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "file1.txt")
+	file2 := filepath.Join(dir, "file2.txt")
+	setupTestFile(t, file1, []string{"Books"})
+	setupTestFile(t, file2, []string{"Books"})
+	db := openTestDB(t, nil, nil)
+
+	if _, err := db.RegisterFileWithMeta(file1, []string{"Books"}, map[string]string{"author": "me"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.RegisterFileWithMeta(file2, []string{"Books"}, map[string]string{"author": "you"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	matches, err := db.GetByMeta(".*", "author", "me")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != file1 {
+		t.Errorf("expected [%s], got %v", file1, matches)
+	}
+
+	// Metadata survives a rewrite
+	if err := db.Canonicalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := db.GetPaths([]string{file2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := records[0].MetaValue("author"); v != "you" {
+		t.Errorf("expected author=you after a rewrite, got %q", v)
+	}
+}
+
+func TestGetExactCategories(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/exact|Movies,Books|2023-07-01T00:00:00Z",
+		"/path/to/superset|Books,Movies,Music|2023-07-01T00:00:00Z",
+		"/path/to/subset|Books|2023-07-01T00:00:00Z",
+	}, nil)
+
+	records, err := db.GetExactCategories(".*", []string{"Books", "Movies"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Path != "/path/to/exact" {
+		t.Errorf("expected only /path/to/exact, got %v", records)
+	}
+
+	records, err = db.GetExactCategories("superset|subset", []string{"Books", "Movies"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected supersets and subsets not to match, got %v", records)
+	}
+
+	// A path re-registered with other categories no longer matches
+	db = openTestDB(t, []string{
+		"/a|A,B|2023-07-01T00:00:00Z",
+		"/a|A|2023-07-02T00:00:00Z",
+	}, nil)
+	records, err = db.GetExactCategories("", []string{"A", "B"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected the stale record not to match, got %v", records)
+	}
+}
+
+func TestGetCategorySubstring(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Project-X,Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|myproj|2023-07-01T00:00:00Z",
+	}, nil)
+
+	records, err := db.GetCategorySubstring(".*", "proj")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Path != "/path/to/file3" {
+		t.Errorf("expected only /path/to/file3, got %v", records)
+	}
+
+	records, err = db.GetCategorySubstringFold(".*", "PROJ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 || records[0].Path != "/path/to/file1" || records[1].Path != "/path/to/file3" {
+		t.Errorf("expected file1 and file3, got %v", records)
+	}
+
+	records, err = db.GetCategorySubstring(".*", "zzz")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no matches, got %v", records)
+	}
+
+	// A path re-registered without the category no longer matches
+	db = openTestDB(t, []string{
+		"/a|Project-X|2023-07-01T00:00:00Z",
+		"/a|Music|2023-07-02T00:00:00Z",
+	}, nil)
+	records, err = db.GetCategorySubstring("", "Proj")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected the stale record not to match, got %v", records)
+	}
+}
+
+func TestAllWithLines(t *testing.T) {
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=|",
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"not a record",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	all, err := db.AllWithLines()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 lines, got %v", all)
+	}
+	if all[0].Line != 2 || all[0].Record.Path != "/path/to/file1" || all[0].Malformed {
+		t.Errorf("unexpected first line %+v", all[0])
+	}
+	if all[1].Line != 3 || !all[1].Malformed || all[1].Text != "not a record" || all[1].Record.Path != "" {
+		t.Errorf("unexpected malformed line %+v", all[1])
+	}
+	if all[2].Line != 4 || all[2].Record.Path != "/path/to/file2" {
+		t.Errorf("unexpected last line %+v", all[2])
+	}
+}
+
+func TestPartition(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|Music|2023-07-01T00:00:00Z",
+		"/other/file4|Books|2023-07-01T00:00:00Z",
+		"/path/to/file3|Books|2023-07-02T00:00:00Z",
+	}, nil)
+
+	matched, unmatched, err := db.Partition("^/path", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all, err := db.latestRecords()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matched)+len(unmatched) != len(all) {
+		t.Fatalf("expected %d records in total, got %d and %d", len(all), len(matched), len(unmatched))
+	}
+
+	got := make(map[string]bool)
+	for _, r := range matched {
+		got[r.Path] = true
+	}
+	for _, r := range unmatched {
+		if got[r.Path] {
+			t.Errorf("expected %s in only one partition", r.Path)
+		}
+	}
+	for _, path := range []string{"/path/to/file1", "/path/to/file2", "/path/to/file3"} {
+		if !got[path] {
+			t.Errorf("expected %s to match", path)
+		}
+	}
+	if len(unmatched) != 1 || unmatched[0].Path != "/other/file4" {
+		t.Errorf("expected only /other/file4 unmatched, got %v", unmatched)
+	}
+
+	// A path that has since lost the category is unmatched, though Get
+	// still finds it by its older record
+	db = openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file1|Music|2023-07-02T00:00:00Z",
+	}, nil)
+	matched, unmatched, err = db.Partition("^/path", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matched) != 0 || len(unmatched) != 1 {
+		t.Errorf("expected the path judged by its latest record, got %v and %v", matched, unmatched)
+	}
+	if found, _ := db.Get("^/path", []string{"Books"}); len(found) != 1 {
+		t.Errorf("expected Get to match the older record, got %v", found)
+	}
+}
+
+func TestGetUnderPrefix(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/projects/alpha/a.txt|Books|2023-07-01T00:00:00Z",
+		"/projects/alpha/sub/b.txt|Books,Music|2023-07-01T00:00:00Z",
+		"/projects/alpha|Books|2023-07-01T00:00:00Z",
+		"/projects/alphabet/c.txt|Books|2023-07-01T00:00:00Z",
+		"/projects/alpha/d.txt|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	for _, prefix := range []string{"/projects/alpha", "/projects/alpha/"} {
+		records, err := db.GetUnderPrefix(prefix, []string{"Books"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var paths []string
+		for _, r := range records {
+			paths = append(paths, r.Path)
+		}
+		expected := "/projects/alpha/a.txt /projects/alpha/sub/b.txt /projects/alpha"
+		if strings.Join(paths, " ") != expected {
+			t.Errorf("expected %s under %q, got %v", expected, prefix, paths)
+		}
+	}
+
+	for _, prefix := range []string{"/projects/alp", "/proj", "/projects/alpha/a"} {
+		records, err := db.GetUnderPrefix(prefix, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(records) != 0 {
+			t.Errorf("expected nothing under %q, got %v", prefix, records)
+		}
+	}
+
+	records, err := db.GetUnderPrefix("/", []string{"Music"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected 2 records under /, got %v", records)
+	}
+
+	// A path re-registered without the category no longer matches
+	db = openTestDB(t, []string{
+		"/projects/alpha/a.txt|Books|2023-07-01T00:00:00Z",
+		"/projects/alpha/a.txt|Music|2023-07-02T00:00:00Z",
+	}, nil)
+	records, err = db.GetUnderPrefix("/projects", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected the stale record not to match, got %v", records)
+	}
+}
+
+func TestCategoryDiff(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, file, []string{"Books", "Music", "Games"})
+	db := openTestDB(t, nil, nil)
+	if _, err := db.RegisterFile(file, []string{"Books", "Music"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	setupTestFile(t, file, []string{"Books", "Games", "Zines"})
+
+	added, removed, err := db.CategoryDiff(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(added, ",") != "Games,Zines" {
+		t.Errorf("expected Games and Zines added, got %v", added)
+	}
+	if strings.Join(removed, ",") != "Music" {
+		t.Errorf("expected Music removed, got %v", removed)
+	}
+
+	other := filepath.Join(t.TempDir(), "other.txt")
+	setupTestFile(t, other, []string{"Books"})
+	if _, _, err := db.CategoryDiff(other); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+}
+
+func TestGetByCategoryCount(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/one|Books|2023-07-01T00:00:00Z",
+		"/path/to/two|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/three|Books,Music,Games|2023-07-01T00:00:00Z",
+		"/path/to/none||2023-07-01T00:00:00Z",
+		"/path/to/one|Books,Music,Games,Zines|2023-07-02T00:00:00Z",
+	}, nil)
+
+	for _, tc := range []struct {
+		min, max int
+		expected string
+	}{
+		{2, 0, "/path/to/one /path/to/two /path/to/three"},
+		{0, 2, "/path/to/two /path/to/none"},
+		{2, 3, "/path/to/two /path/to/three"},
+	} {
+		records, err := db.GetByCategoryCount(".*", tc.min, tc.max)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var paths []string
+		for _, r := range records {
+			paths = append(paths, r.Path)
+		}
+		if strings.Join(paths, " ") != tc.expected {
+			t.Errorf("min %d, max %d: expected %s, got %v", tc.min, tc.max, tc.expected, paths)
+		}
+	}
+}
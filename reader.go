@@ -0,0 +1,32 @@
+package catobase
+
+import "io"
+
+// streamName stands in for the database path in errors about a stream.
+const streamName = "<stream>"
+
+// QueryReader returns the paths matching regex and categories, with the same
+// rules as DB.Get, from a database read from r, such as os.Stdin or a pipe.
+// The stream is read once, front to back, without seeking. A nil opts uses
+// the defaults. Only queries are available this way: writes need the
+// database to be a file, opened with Open.
+func QueryReader(r io.Reader, regex string, categories []string, opts *Options) ([]string, error) {
+	db, err := Open(streamName, opts)
+	if err != nil {
+		return nil, err
+	}
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return nil, err
+	}
+	categories = db.normalize(categories)
+
+	each := func(fn func(r Record) error) error {
+		return db.filterRecords(func(fn func(l rawLine) error) error {
+			return db.readLines(r, fn)
+		}, fn)
+	}
+	return db.collectPaths(each, re, func(r Record) bool {
+		return db.expand(r.Categories).HasAll(categories)
+	}, 0)
+}
@@ -0,0 +1,35 @@
+package catobase
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestQueryReaderPipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "#catobase v1 sep=#\n")
+		io.WriteString(pw, "/path/to/file1#Books,Movies#2023-07-01T00:00:00Z\n")
+		io.WriteString(pw, "/path/to/file2#Music#2023-07-01T00:00:00Z\n")
+		io.WriteString(pw, "/path/to/file3#Books#2023-07-01T00:00:00Z\n")
+		pw.Close()
+	}()
+
+	matches, err := QueryReader(pr, ".*", []string{"Books"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"/path/to/file1", "/path/to/file3"}
+	if strings.Join(matches, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, matches)
+	}
+}
+
+func TestQueryReaderStrict(t *testing.T) {
+	r := strings.NewReader("/path/to/file1|Books|2023-07-01T00:00:00Z\nnot a record\n")
+	_, err := QueryReader(r, ".*", nil, &Options{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), streamName+":2:") {
+		t.Errorf("expected a parse error naming line 2 of the stream, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// defaultSeparator delimits record fields when no separator is configured.
+const defaultSeparator = "|"
+
+// Record is a single registration stored in the database.
+type Record struct {
+	Path       string    `json:"path"`
+	Categories []string  `json:"categories"`
+	Registered time.Time `json:"registered"`
+	// Meta holds free-form key-value pairs, stored in an optional fourth
+	// field as "k=v;k=v". Records without the field have no metadata.
+	Meta map[string]string `json:"meta,omitempty"`
+
+	// rawTime is the timestamp field as read, kept when it did not parse so
+	// a rewrite stores it unchanged.
+	rawTime string
+}
+
+// copyMetaKey is the metadata key under which the location of a file's copy
+// is recorded, see Options.RecordCopyPath.
+const copyMetaKey = "copy"
+
+// CopyPath returns where the copy made when the file was registered went, or
+// "" if none was recorded.
+func (r Record) CopyPath() string {
+	return r.Meta[copyMetaKey]
+}
+
+// MetaValue returns the metadata value stored under key.
+func (r Record) MetaValue(key string) (string, bool) {
+	v, ok := r.Meta[key]
+	return v, ok
+}
+
+// ErrMalformedRecord is returned for a line with too few fields to be a record.
+var ErrMalformedRecord = errors.New("malformed record")
+
+// maxSnippet is the number of bytes of an offending line quoted in a ParseError.
+const maxSnippet = 40
+
+// ParseError reports a database line that could not be parsed.
+type ParseError struct {
+	Path string // database file
+	Line int    // 1-based line number
+	Text string // the offending line
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	snippet := e.Text
+	if len(snippet) > maxSnippet {
+		snippet = snippet[:maxSnippet] + "..."
+	}
+	return fmt.Sprintf("%s:%d: %v: %q", e.Path, e.Line, e.Err, snippet)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// separatorCandidates are the single-character separators ParseRecord
+// recognizes when none is given.
+const separatorCandidates = "|#;"
+
+// ParseRecord parses a database line written with the given separator.
+// An empty separator is detected from the line itself, see detectSeparator.
+// Timestamps stored with any UTC offset are accepted and converted to UTC.
+// A timestamp that does not parse leaves Registered as the zero time rather
+// than failing the whole record, and is written back as it was.
+func ParseRecord(line, sep string) (Record, error) {
+	if sep == "" {
+		sep = detectSeparator(line)
+	}
+	parts := strings.Split(line, sep)
+	if len(parts) < 3 {
+		return Record{}, ErrMalformedRecord
+	}
+
+	r := Record{Path: parts[0]}
+	if parts[1] != "" {
+		r.Categories = strings.Split(parts[1], ",")
+	}
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(parts[2])); err == nil {
+		r.Registered = t.UTC()
+	} else {
+		r.rawTime = parts[2]
+	}
+	if len(parts) > 3 {
+		r.Meta = parseMeta(strings.Join(parts[3:], sep))
+	}
+	return r, nil
+}
+
+// parseMeta parses a metadata field. Pairs without "=" are skipped.
+func parseMeta(field string) map[string]string {
+	var meta map[string]string
+	for _, pair := range strings.Split(field, ";") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[k] = v
+	}
+	return meta
+}
+
+// formatMeta renders meta as a metadata field, with keys sorted.
+func formatMeta(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + meta[k]
+	}
+	return strings.Join(pairs, ";")
+}
+
+// detectSeparator guesses the separator of line among separatorCandidates.
+// A timestamp never contains a candidate, so the character just before a
+// parseable timestamp at the end of the line is taken first; failing that,
+// the first candidate in the line, which is the one between the path and the
+// categories. Detection is a heuristic: it cannot find separators longer than
+// one character, and without a timestamp a path containing a candidate hides
+// the real separator. It falls back to the default "|".
+func detectSeparator(line string) string {
+	if i := strings.LastIndexAny(line, separatorCandidates); i >= 0 {
+		if _, err := time.Parse(time.RFC3339, line[i+1:]); err == nil {
+			return line[i : i+1]
+		}
+	}
+	if i := strings.IndexAny(line, separatorCandidates); i >= 0 {
+		return line[i : i+1]
+	}
+	return defaultSeparator
+}
+
+// formatRecord renders r as a database line using the given separator. The
+// timestamp is always written in UTC, so lines written in different time
+// zones sort and compare alike.
+func formatRecord(r Record, sep string) string {
+	if sep == "" {
+		sep = defaultSeparator
+	}
+	cat := strings.Join(r.Categories, ",")
+	stamp := r.Registered.UTC().Format(time.RFC3339)
+	if r.Registered.IsZero() && r.rawTime != "" {
+		stamp = r.rawTime
+	}
+	line := fmt.Sprintf("%s%s%s%s%s", r.Path, sep, cat, sep, stamp)
+	if len(r.Meta) > 0 {
+		line += sep + formatMeta(r.Meta)
+	}
+	return line
+}
+
+// timestampChars are the characters that can appear in an RFC 3339
+// timestamp, which a separator must avoid for the timestamp field to split
+// off intact.
+const timestampChars = "0123456789-:TZ+."
+
+// validateSeparator checks that sep can delimit record fields, and be named
+// in a header, without records reading back differently.
+func validateSeparator(sep string) error {
+	if sep == "" || strings.ContainsAny(sep, ",\n") {
+		return errors.New("separator must not be empty or contain a comma or newline")
+	}
+	if strings.IndexFunc(sep, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("separator %q must not contain whitespace", sep)
+	}
+	if strings.ContainsAny(sep, timestampChars) {
+		return fmt.Errorf("separator %q must not contain any of %q, which appear in timestamps", sep, timestampChars)
+	}
+	return nil
+}
+
+// validatePath checks that path can be stored in a record written with sep.
+func validatePath(path, sep string) error {
+	if strings.Contains(path, "\n") {
+		return fmt.Errorf("path %q must not contain a newline", path)
+	}
+	if strings.Contains(path, sep) {
+		return fmt.Errorf("path %q must not contain the separator %q", path, sep)
+	}
+	return nil
+}
+
+// validateCategories checks that every category can be stored in a record
+// written with sep without corrupting the line.
+func validateCategories(categories []string, sep string) error {
+	for _, c := range categories {
+		if strings.TrimSpace(c) == "" {
+			return errors.New("category name must not be empty")
+		}
+		if !utf8.ValidString(c) {
+			return fmt.Errorf("category %q is not valid UTF-8", c)
+		}
+		if strings.ContainsAny(c, ",\n") {
+			return fmt.Errorf("category %q must not contain a comma or newline", c)
+		}
+		if strings.Contains(c, sep) {
+			return fmt.Errorf("category %q must not contain the separator %q", c, sep)
+		}
+	}
+	return nil
+}
+
+// validateRecord checks that every field of r can be stored in a record
+// written with sep.
+func validateRecord(r Record, sep string) error {
+	if err := validatePath(r.Path, sep); err != nil {
+		return err
+	}
+	if err := validateCategories(r.Categories, sep); err != nil {
+		return err
+	}
+	if strings.Contains(r.rawTime, sep) {
+		return fmt.Errorf("timestamp %q must not contain the separator %q", r.rawTime, sep)
+	}
+	return validateMeta(r.Meta, sep)
+}
+
+// validateMeta checks that meta can be stored in a record written with sep.
+func validateMeta(meta map[string]string, sep string) error {
+	if len(meta) == 0 {
+		return nil
+	}
+	if strings.ContainsAny(sep, ";=") {
+		return fmt.Errorf("metadata cannot be stored with the separator %q", sep)
+	}
+	for k, v := range meta {
+		if k == "" {
+			return errors.New("metadata key must not be empty")
+		}
+		if strings.ContainsAny(k, ";=\n") || strings.ContainsAny(v, ";\n") {
+			return fmt.Errorf("metadata %q=%q must not contain ';', '=' in the key, or a newline", k, v)
+		}
+		if strings.Contains(k, sep) || strings.Contains(v, sep) {
+			return fmt.Errorf("metadata %q=%q must not contain the separator %q", k, v, sep)
+		}
+	}
+	return nil
+}
+
+// normalizeCategories returns categories in Unicode normalization form C, so
+// that composed and decomposed spellings of a name compare equal.
+func normalizeCategories(categories []string) []string {
+	if categories == nil {
+		return nil
+	}
+	normalized := make([]string, len(categories))
+	for i, c := range categories {
+		normalized[i] = norm.NFC.String(c)
+	}
+	return normalized
+}
@@ -0,0 +1,176 @@
+package catobase
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateCategoriesRejectsInvalidUTF8(t *testing.T) {
+	err := validateCategories([]string{"Books", "caf\xe9"}, "|")
+	if err == nil {
+		t.Fatalf("expected error for invalid UTF-8")
+	}
+	if err.Error() != `category "caf\xe9" is not valid UTF-8` {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestNormalizeNFC(t *testing.T) {
+	composed := "caf\u00e9"
+	decomposed := "cafe\u0301"
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{decomposed})
+
+	// Without normalization the spellings differ
+	db := openTestDB(t, []string{}, nil)
+	if _, err := db.RegisterFile(testFile, []string{composed}, false); err == nil {
+		t.Errorf("expected the composed spelling not to match without normalization")
+	}
+
+	db = openTestDB(t, []string{
+		"/path/to/old|" + decomposed + "|2023-07-01T00:00:00Z",
+	}, &Options{NormalizeNFC: true})
+	if _, err := db.RegisterFile(testFile, []string{composed}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	for _, r := range records {
+		if r.Categories[0] != composed {
+			t.Errorf("expected %s to read back composed, got %q", r.Path, r.Categories[0])
+		}
+	}
+	matches, err := db.Get(".*", []string{decomposed})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Errorf("expected both records to match the decomposed query, got %v", matches)
+	}
+}
+
+func TestParseErrorLineNumber(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books|2023-07-01T00:00:00Z",
+		long,
+	}, &Options{Strict: true})
+
+	_, err := db.Get(".*", nil)
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if perr.Line != 3 {
+		t.Errorf("expected line 3, got %d", perr.Line)
+	}
+	if !errors.Is(err, ErrMalformedRecord) {
+		t.Errorf("expected error to wrap ErrMalformedRecord")
+	}
+	if !strings.Contains(err.Error(), ":3: ") || !strings.Contains(err.Error(), strings.Repeat("x", maxSnippet)+`..."`) {
+		t.Errorf("expected truncated snippet with line number, got %v", err)
+	}
+	if strings.Contains(err.Error(), long) {
+		t.Errorf("expected the snippet to be truncated, got %v", err)
+	}
+}
+
+func TestParseRecordDetectsSeparator(t *testing.T) {
+	lines := []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2#Books#2023-07-01T00:00:00Z",
+		"/path/to/file3;Books,Music;2023-07-01T00:00:00Z",
+		"/path/with#hash|Books|2023-07-01T00:00:00Z",
+	}
+	expected := []string{"/path/to/file1", "/path/to/file2", "/path/to/file3", "/path/with#hash"}
+	for i, line := range lines {
+		r, err := ParseRecord(line, "")
+		if err != nil {
+			t.Fatalf("line %d: unexpected error: %v", i, err)
+		}
+		if r.Path != expected[i] {
+			t.Errorf("line %d: expected path %q, got %q", i, expected[i], r.Path)
+		}
+		if len(r.Categories) == 0 || r.Categories[0] != "Books" {
+			t.Errorf("line %d: unexpected categories %v", i, r.Categories)
+		}
+		if r.Registered.IsZero() {
+			t.Errorf("line %d: expected the timestamp to parse", i)
+		}
+	}
+}
+
+func TestRecordMetaRoundTrip(t *testing.T) {
+	r := Record{
+		Path:       "/path/to/file",
+		Categories: []string{"Books"},
+		Registered: time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC),
+		Meta:       map[string]string{"priority": "3", "author": "me"},
+	}
+	line := formatRecord(r, "|")
+	if line != "/path/to/file|Books|2023-07-01T00:00:00Z|author=me;priority=3" {
+		t.Fatalf("unexpected line %q", line)
+	}
+	parsed, err := ParseRecord(line, "|")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, ok := parsed.MetaValue("author"); !ok || v != "me" {
+		t.Errorf("expected author=me, got %q", v)
+	}
+	if v, ok := parsed.MetaValue("priority"); !ok || v != "3" {
+		t.Errorf("expected priority=3, got %q", v)
+	}
+
+	// Three-field records have no metadata
+	parsed, err = ParseRecord("/path/to/file|Books|2023-07-01T00:00:00Z", "|")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.Meta != nil {
+		t.Errorf("expected no metadata, got %v", parsed.Meta)
+	}
+
+	if err := validateMeta(map[string]string{"a=b": "c"}, "|"); err == nil {
+		t.Errorf("expected error for a key containing '='")
+	}
+}
+
+func TestTimestampsStoredInUTC(t *testing.T) {
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	registered := time.Date(2023, 7, 1, 3, 0, 0, 0, zone)
+	line := formatRecord(Record{Path: "/path/to/file", Categories: []string{"Books"}, Registered: registered}, "|")
+	if line != "/path/to/file|Books|2023-06-30T22:00:00Z" {
+		t.Errorf("expected a UTC timestamp, got %q", line)
+	}
+
+	db := openTestDB(t, nil, nil)
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if !strings.HasSuffix(lines[0], "Z") {
+		t.Errorf("expected the stored timestamp in UTC, got %q", lines[0])
+	}
+
+	// Timestamps written with an offset still parse to the same instant
+	r, err := ParseRecord("/path/to/file|Books|2023-07-01T03:00:00+05:00", "|")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.Registered.Equal(registered) || r.Registered.Location() != time.UTC {
+		t.Errorf("expected %v in UTC, got %v", registered, r.Registered)
+	}
+}
@@ -0,0 +1,55 @@
+package catobase
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// shardFileName returns the file in a shard directory holding category.
+// Names are path-escaped so any category maps to a single file.
+func shardFileName(category string) string {
+	return url.PathEscape(category) + ".catodb"
+}
+
+// Shard writes, into dir, one database file per distinct category listing
+// every record that carries it, so a single category can be looked up
+// without scanning the whole database. A record with several categories is
+// copied into each of their shards; records without categories appear in
+// none. Shard files use the database's separator and are named after the
+// path-escaped category with a ".catodb" suffix, e.g. "Books.catodb".
+func (db *DB) Shard(dir string) error {
+	sep, err := db.separator()
+	if err != nil {
+		return err
+	}
+	records, err := db.records()
+	if err != nil {
+		return err
+	}
+
+	shards := make(map[string][]Record)
+	var order []string
+	for _, r := range records {
+		for _, c := range NewCategorySet(r.Categories...).Slice() {
+			if _, ok := shards[c]; !ok {
+				order = append(order, c)
+			}
+			shards[c] = append(shards[c], r)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, c := range order {
+		shard, err := Open(filepath.Join(dir, shardFileName(c)), &Options{Separator: sep, Header: db.opts.Header})
+		if err != nil {
+			return err
+		}
+		if err := shard.rewrite(shards[c], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package catobase
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShard(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|Sci/Fi|2023-07-01T00:00:00Z",
+	}, nil)
+	dir := filepath.Join(t.TempDir(), "shards")
+
+	if err := db.Shard(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string][]string{
+		"Books.catodb":    {"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z"},
+		"Movies.catodb":   {"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z"},
+		"Music.catodb":    {"/path/to/file2|Music|2023-07-01T00:00:00Z"},
+		"Sci%2FFi.catodb": {"/path/to/file3|Sci/Fi|2023-07-01T00:00:00Z"},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read shard dir: %v", err)
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("expected %d shards, got %d", len(expected), len(entries))
+	}
+	for name, want := range expected {
+		lines, err := readFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("expected shard %s: %v", name, err)
+			continue
+		}
+		if len(lines) != len(want) || lines[0] != want[0] {
+			t.Errorf("shard %s: expected %v, got %v", name, want, lines)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package catobase
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrStaleSnapshot is returned by Snapshot methods once the DB that took the
+// snapshot has been written to.
+var ErrStaleSnapshot = errors.New("snapshot is stale")
+
+// Snapshot is an in-memory copy of the database records. Its methods never
+// touch disk and are safe for concurrent use. Only writes made through the
+// DB that took the snapshot invalidate it; changes by other processes or
+// handles are not detected.
+type Snapshot struct {
+	db      *DB
+	gen     uint64
+	records []Record
+}
+
+// Snapshot loads every record into memory for repeated queries.
+func (db *DB) Snapshot() (*Snapshot, error) {
+	gen := atomic.LoadUint64(&db.gen)
+	records, err := db.records()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{db: db, gen: gen, records: records}, nil
+}
+
+// Valid reports whether the snapshot still reflects the DB's writes.
+func (s *Snapshot) Valid() bool {
+	return atomic.LoadUint64(&s.db.gen) == s.gen
+}
+
+// Query returns the paths matching regex and categories with the same rules
+// as DB.Get.
+func (s *Snapshot) Query(regex string, categories []string) ([]string, error) {
+	if !s.Valid() {
+		return nil, ErrStaleSnapshot
+	}
+	re, err := s.db.compilePathPattern(regex)
+	if err != nil {
+		return nil, err
+	}
+	categories = s.db.normalize(categories)
+	return s.db.collectPaths(s.each, re, func(r Record) bool {
+		return s.db.expand(r.Categories).HasAll(categories)
+	}, 0)
+}
+
+// Count returns the number of paths Query would return.
+func (s *Snapshot) Count(regex string, categories []string) (int, error) {
+	matches, err := s.Query(regex, categories)
+	if err != nil {
+		return 0, err
+	}
+	return len(matches), nil
+}
+
+// each calls fn for every record in the snapshot.
+func (s *Snapshot) each(fn func(r Record) error) error {
+	for _, r := range s.records {
+		if err := fn(r); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
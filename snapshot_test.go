@@ -0,0 +1,78 @@
+package catobase
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotMatchesLiveQueries(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music,Games|2023-07-01T00:00:00Z",
+		"/path/to/file1|Books|2023-07-02T00:00:00Z",
+		"/other/file3|Books|2023-07-01T00:00:00Z",
+	}, nil)
+
+	snap, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	queries := []struct {
+		regex      string
+		categories []string
+	}{
+		{"file", []string{"Books"}},
+		{"^/path", nil},
+		{".*", []string{"Music", "Games"}},
+		{"nothing", nil},
+	}
+	var wg sync.WaitGroup
+	for _, q := range queries {
+		live, err := db.Get(q.regex, q.categories)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		wg.Add(1)
+		go func(regex string, categories []string, live []string) {
+			defer wg.Done()
+			got, err := snap.Query(regex, categories)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if strings.Join(got, " ") != strings.Join(live, " ") {
+				t.Errorf("query %q %v: snapshot returned %v, live returned %v", regex, categories, got, live)
+			}
+			count, err := snap.Count(regex, categories)
+			if err != nil || count != len(live) {
+				t.Errorf("query %q %v: expected count %d, got %d (%v)", regex, categories, len(live), count, err)
+			}
+		}(q.regex, q.categories, live)
+	}
+	wg.Wait()
+}
+
+func TestSnapshotInvalidatedByWrites(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+	db := openTestDB(t, []string{}, nil)
+
+	snap, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if snap.Valid() {
+		t.Errorf("expected snapshot to be invalidated")
+	}
+	if _, err := snap.Query(".*", nil); !errors.Is(err, ErrStaleSnapshot) {
+		t.Errorf("expected ErrStaleSnapshot, got %v", err)
+	}
+}
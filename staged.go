@@ -0,0 +1,195 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AppendStrategy selects how records are appended to the database.
+type AppendStrategy int
+
+const (
+	// AppendInPlace appends records to the database file opened with
+	// O_APPEND. It is cheap, but concurrent writers can interleave their
+	// lines where the filesystem does not make such appends atomic.
+	AppendInPlace AppendStrategy = iota
+
+	// AppendStaged writes each batch of appended records to a new file in
+	// the "<db>.staged" directory, complete before it is renamed into
+	// place, so writers never share a file. Reads take the database followed
+	// by the staged files in the order they were written, and any rewrite,
+	// such as MergeStaged, folds them back into the database. The cost is a
+	// directory listing and one file per pending batch on every read; a
+	// reader racing a rewrite may briefly see staged records twice, never
+	// lose them.
+	AppendStaged
+)
+
+// stagedSuffix marks complete staged files; others are still being written.
+const stagedSuffix = ".rec"
+
+// stagingDir returns the directory holding staged appends.
+func (db *DB) stagingDir() string {
+	return db.path + ".staged"
+}
+
+// stagedFiles returns the complete staged files in the order they were
+// written: the ones claimed by the writer holding the lock, if any.
+func (db *DB) stagedFiles() ([]string, error) {
+	if claimed := db.claimed.Load(); claimed != nil {
+		return *claimed, nil
+	}
+	return db.listStaged()
+}
+
+// listStaged lists the complete staged files in the staging directory.
+func (db *DB) listStaged() ([]string, error) {
+	entries, err := os.ReadDir(db.stagingDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), stagedSuffix) {
+			files = append(files, filepath.Join(db.stagingDir(), e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// stage writes lines to a new staged file.
+func (db *DB) stage(lines []string) error {
+	if err := os.MkdirAll(db.stagingDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", db.stagingDir(), err)
+	}
+	// The timestamp prefix orders staged files by when they were written
+	tmp, err := os.CreateTemp(db.stagingDir(), fmt.Sprintf("%020d-*.tmp", time.Now().UnixNano()))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.WriteString(tmp, strings.Join(lines, "\n")+"\n")
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), strings.TrimSuffix(tmp.Name(), ".tmp")+stagedSuffix); err != nil {
+		return err
+	}
+	db.invalidate()
+	return nil
+}
+
+// claimStaged runs fn, a write holding writeMu, against the staged files
+// present when it starts. Its reads see only those, and a rewrite removes
+// exactly those, so appends staged meanwhile by others are neither lost nor
+// duplicated.
+func (db *DB) claimStaged(fn func() error) error {
+	if db.opts.Append != AppendStaged {
+		return fn()
+	}
+	files, err := db.listStaged()
+	if err != nil {
+		return err
+	}
+	db.claimed.Store(&files)
+	defer db.claimed.Store(nil)
+	return fn()
+}
+
+// removeClaimed removes the claimed staged files once a rewrite holds them.
+func (db *DB) removeClaimed() {
+	claimed := db.claimed.Load()
+	if claimed == nil {
+		return
+	}
+	for _, f := range *claimed {
+		os.Remove(f)
+	}
+	empty := []string{}
+	db.claimed.Store(&empty)
+}
+
+// openStagedReader opens the database followed by its staged files. The
+// staged files are opened first: a rewrite removes them only after renaming
+// the new database into place, so a file that has vanished is already in
+// the database opened next.
+func (db *DB) openStagedReader() (io.ReadCloser, error) {
+	files, err := db.stagedFiles()
+	if err != nil {
+		return nil, err
+	}
+	var staged []io.ReadCloser
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			newMultiReadCloser(staged).Close()
+			return nil, err
+		}
+		staged = append(staged, f)
+	}
+
+	main, err := db.openMain()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) || len(staged) == 0 {
+			newMultiReadCloser(staged).Close()
+			return nil, err
+		}
+		return newMultiReadCloser(staged), nil
+	}
+	return newMultiReadCloser(append([]io.ReadCloser{main}, staged...)), nil
+}
+
+// multiReadCloser reads its parts one after the other and closes them all.
+type multiReadCloser struct {
+	io.Reader
+	parts []io.ReadCloser
+}
+
+func newMultiReadCloser(parts []io.ReadCloser) *multiReadCloser {
+	readers := make([]io.Reader, len(parts))
+	for i, r := range parts {
+		readers[i] = r
+	}
+	return &multiReadCloser{Reader: io.MultiReader(readers...), parts: parts}
+}
+
+func (m *multiReadCloser) Close() error {
+	var err error
+	for _, r := range m.parts {
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// MergeStaged folds the staged appends of an AppendStaged database into the
+// database file and removes them. Lines that do not parse are kept.
+func (db *DB) MergeStaged() error {
+	return db.update(func(records []Record) ([]Record, error) {
+		if claimed := db.claimed.Load(); claimed == nil || len(*claimed) == 0 {
+			return nil, errUnchanged
+		}
+		return records, nil
+	})
+}
@@ -0,0 +1,204 @@
+package catobase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestAppendStagedConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, ".catodb")
+	setupTestFile(t, dbPath, []string{"/path/to/old|Music|2023-07-01T00:00:00Z"})
+
+	// A writer that died mid-append leaves an incomplete file behind
+	os.MkdirAll(dbPath+".staged", 0755)
+	setupTestFile(t, filepath.Join(dbPath+".staged", "00000000000000000001-crash.tmp"), []string{"/path/to/half|Boo"})
+
+	const writers, perWriter = 8, 5
+	file := func(w, i int) string {
+		return filepath.Join(dir, fmt.Sprintf("file-%d-%d.txt", w, i))
+	}
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			setupTestFile(t, file(w, i), []string{"Books"})
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Each writer has its own handle, as separate processes would
+			db, err := Open(dbPath, &Options{Append: AppendStaged})
+			if err != nil {
+				errs <- err
+				return
+			}
+			for i := 0; i < perWriter; i++ {
+				if _, err := db.RegisterFile(file(w, i), []string{"Books"}, false); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	db, err := Open(dbPath, &Options{Append: AppendStaged, Strict: true})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("expected every line to parse: %v", err)
+	}
+	if len(matches) != writers*perWriter {
+		t.Errorf("expected %d records, got %d", writers*perWriter, len(matches))
+	}
+
+	// Merging folds the staged files into the database
+	if err := db.MergeStaged(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if staged, _ := db.listStaged(); len(staged) != 0 {
+		t.Errorf("expected no staged files after merging, got %v", staged)
+	}
+	lines, err := readFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != writers*perWriter+1 {
+		t.Errorf("expected %d lines in the database, got %d", writers*perWriter+1, len(lines))
+	}
+}
+
+func TestAppendStagedFolderWalk(t *testing.T) {
+	folder := t.TempDir()
+	for i := 0; i < 50; i++ {
+		setupTestFile(t, filepath.Join(folder, fmt.Sprintf("file%d.txt", i)), []string{"Books"})
+	}
+	db := openTestDB(t, nil, &Options{Append: AppendStaged})
+
+	registered, err := db.RegisterFolder(folder, `\.txt$`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 50 {
+		t.Errorf("expected 50 registered files, got %d", len(registered))
+	}
+	staged, err := db.listStaged()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(staged) != 1 {
+		t.Errorf("expected the walk to stage a single file, got %d", len(staged))
+	}
+	matches, err := db.Get(".*", []string{"Books"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 50 {
+		t.Errorf("expected 50 records, got %d", len(matches))
+	}
+}
+
+// tornFile splits every write in two and runs between after the first half,
+// as a filesystem that does not make appends atomic may let another writer's
+// append land in the middle.
+type tornFile struct {
+	storageFile
+	between func()
+}
+
+func (f *tornFile) Write(p []byte) (int, error) {
+	n, err := f.storageFile.Write(p[:len(p)/2])
+	if err != nil {
+		return n, err
+	}
+	f.between()
+	m, err := f.storageFile.Write(p[len(p)/2:])
+	return n + m, err
+}
+
+func TestAppendTornWrites(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		strategy AppendStrategy
+		clean    bool
+	}{
+		{"in place", AppendInPlace, false},
+		{"staged", AppendStaged, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath := filepath.Join(dir, ".catodb")
+			setupTestFile(t, dbPath, []string{"/path/to/old|Music|2023-07-01T00:00:00Z"})
+			first, second := filepath.Join(dir, "first.txt"), filepath.Join(dir, "second.txt")
+			setupTestFile(t, first, []string{"Books"})
+			setupTestFile(t, second, []string{"Books"})
+
+			a, err := Open(dbPath, &Options{Append: tc.strategy})
+			if err != nil {
+				t.Fatalf("failed to open db: %v", err)
+			}
+			b, err := Open(dbPath, &Options{Append: tc.strategy})
+			if err != nil {
+				t.Fatalf("failed to open db: %v", err)
+			}
+
+			// b registers while a's append is half written
+			landed := false
+			a.openFile = func(name string, flag int, perm os.FileMode) (storageFile, error) {
+				f, err := openOSFile(name, flag, perm)
+				if err != nil {
+					return nil, err
+				}
+				return &tornFile{storageFile: f, between: func() {
+					if landed {
+						return
+					}
+					landed = true
+					if _, err := b.RegisterFile(second, []string{"Books"}, false); err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}}, nil
+			}
+			if _, err := a.RegisterFile(first, []string{"Books"}, false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// Staged appends never write to the database file itself
+			if landed == tc.clean {
+				t.Fatalf("expected the torn write to be reached only in place")
+			}
+			if !landed {
+				if _, err := b.RegisterFile(second, []string{"Books"}, false); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			db, err := Open(dbPath, &Options{Append: tc.strategy, Strict: true})
+			if err != nil {
+				t.Fatalf("failed to open db: %v", err)
+			}
+			records, err := db.GetPaths([]string{first, second})
+			if tc.clean {
+				if err != nil {
+					t.Fatalf("expected every line to parse: %v", err)
+				}
+				if len(records) != 2 {
+					t.Errorf("expected both records intact, got %v", records)
+				}
+			} else if err == nil && len(records) == 2 {
+				t.Errorf("expected the interleaved append to corrupt a record, got %v", records)
+			}
+		})
+	}
+}
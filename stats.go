@@ -0,0 +1,147 @@
+package catobase
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CategoryCount is the number of files carrying a category.
+type CategoryCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// CategoryCounts returns how many files carry each category, judging every
+// path by its latest record.
+func (db *DB) CategoryCounts() (map[string]int, error) {
+	records, err := db.latestRecords()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, r := range records {
+		for c := range NewCategorySet(r.Categories...) {
+			counts[c]++
+		}
+	}
+	return counts, nil
+}
+
+// TopCategories returns the n most used categories, as counted by
+// CategoryCounts, by count descending and then by name. A non-positive n
+// returns every category.
+func (db *DB) TopCategories(n int) ([]CategoryCount, error) {
+	counts, err := db.CategoryCounts()
+	if err != nil {
+		return nil, err
+	}
+	top := make([]CategoryCount, 0, len(counts))
+	for name, count := range counts {
+		top = append(top, CategoryCount{Name: name, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Name < top[j].Name
+	})
+	if n > 0 && n < len(top) {
+		top = top[:n]
+	}
+	return top, nil
+}
+
+// CoOccurrence counts, for every pair of categories carried together by a
+// file, how many files carry both, judging every path by its latest record.
+// Each pair is keyed once, with its names in sorted order.
+func (db *DB) CoOccurrence() (map[[2]string]int, error) {
+	records, err := db.latestRecords()
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[[2]string]int)
+	for _, r := range records {
+		names := NewCategorySet(r.Categories...).Slice()
+		for i, a := range names {
+			for _, b := range names[i+1:] {
+				pairs[[2]string{a, b}]++
+			}
+		}
+	}
+	return pairs, nil
+}
+
+// SortByCategoryCount returns the latest record of every path ordered by how
+// many distinct categories it carries, fewest first, or most first if desc is
+// set. Ties are broken by path, ascending either way.
+func (db *DB) SortByCategoryCount(desc bool) ([]Record, error) {
+	records, err := db.latestRecords()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(records))
+	for _, r := range records {
+		counts[r.Path] = NewCategorySet(r.Categories...).Len()
+	}
+	sort.Slice(records, func(i, j int) bool {
+		ci, cj := counts[records[i].Path], counts[records[j].Path]
+		if ci != cj {
+			if desc {
+				return ci > cj
+			}
+			return ci < cj
+		}
+		return records[i].Path < records[j].Path
+	})
+	return records, nil
+}
+
+// Histogram counts the records registered in each bucket of the given
+// width. Buckets are keyed by their start in UTC, aligned as by
+// time.Truncate. Records with an unparseable timestamp are skipped.
+func (db *DB) Histogram(bucket time.Duration) (map[time.Time]int, error) {
+	if bucket <= 0 {
+		return nil, errors.New("bucket must be positive")
+	}
+	counts := make(map[time.Time]int)
+	err := db.scan(func(r Record) error {
+		if !r.Registered.IsZero() {
+			counts[r.Registered.UTC().Truncate(bucket)]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// CaseCollisions returns the category names that are spelled with more than
+// one letter case across the database, such as "Books" and "books". Each
+// entry maps the lower-case name to its spellings, sorted.
+func (db *DB) CaseCollisions() (map[string][]string, error) {
+	spellings := make(map[string]CategorySet)
+	err := db.scan(func(r Record) error {
+		for _, c := range r.Categories {
+			key := strings.ToLower(c)
+			if spellings[key] == nil {
+				spellings[key] = NewCategorySet()
+			}
+			spellings[key].Add(c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	collisions := make(map[string][]string)
+	for key, set := range spellings {
+		if set.Len() > 1 {
+			collisions[key] = set.Slice()
+		}
+	}
+	return collisions, nil
+}
@@ -0,0 +1,157 @@
+package catobase
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCategoryCounts(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file1|Books,Movies|2023-07-02T00:00:00Z",
+	}, nil)
+
+	counts, err := db.CategoryCounts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]int{"Books": 2, "Movies": 1, "Music": 1}
+	if len(counts) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, counts)
+	}
+	for name, n := range expected {
+		if counts[name] != n {
+			t.Errorf("expected %s to be counted %d times, got %d", name, n, counts[name])
+		}
+	}
+}
+
+func TestTopCategories(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file2|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file3|Music,Movies,Games|2023-07-01T00:00:00Z",
+		"/path/to/file4|Books|2023-07-01T00:00:00Z",
+	}, nil)
+
+	top, err := db.TopCategories(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []CategoryCount{{"Books", 3}, {"Movies", 2}}
+	if len(top) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, top)
+	}
+	for i := range expected {
+		if top[i] != expected[i] {
+			t.Errorf("expected %v at %d, got %v", expected[i], i, top[i])
+		}
+	}
+}
+
+func TestCoOccurrence(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music,Books,Games|2023-07-01T00:00:00Z",
+		"/path/to/file3|Books|2023-07-01T00:00:00Z",
+		"/path/to/file3|Music,Books|2023-07-02T00:00:00Z",
+	}, nil)
+
+	pairs, err := db.CoOccurrence()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[[2]string]int{
+		{"Books", "Music"}: 3,
+		{"Books", "Games"}: 1,
+		{"Games", "Music"}: 1,
+	}
+	if len(pairs) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, pairs)
+	}
+	for pair, count := range expected {
+		if pairs[pair] != count {
+			t.Errorf("expected %v to co-occur %d times, got %d", pair, count, pairs[pair])
+		}
+	}
+}
+
+func TestSortByCategoryCount(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/b|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/c|Books|2023-07-01T00:00:00Z",
+		"/path/to/a|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/d|Books,Music,Games|2023-07-01T00:00:00Z",
+		"/path/to/c|Books,Music,Games,Zines|2023-07-02T00:00:00Z",
+	}, nil)
+
+	for _, tc := range []struct {
+		desc     bool
+		expected string
+	}{
+		{false, "/path/to/a /path/to/b /path/to/d /path/to/c"},
+		{true, "/path/to/c /path/to/d /path/to/a /path/to/b"},
+	} {
+		records, err := db.SortByCategoryCount(tc.desc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var paths []string
+		for _, r := range records {
+			paths = append(paths, r.Path)
+		}
+		if strings.Join(paths, " ") != tc.expected {
+			t.Errorf("desc=%v: expected %s, got %v", tc.desc, tc.expected, paths)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T01:00:00Z",
+		"/path/to/file2|Music|2023-07-01T23:59:59Z",
+		"/path/to/file3|Music|2023-07-02T12:00:00Z",
+		"/path/to/file4|Music|not a time",
+		"/path/to/file5|Music|2023-07-04T00:00:00Z",
+	}, nil)
+
+	histogram, err := db.Histogram(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	day := func(d int) time.Time { return time.Date(2023, 7, d, 0, 0, 0, 0, time.UTC) }
+	expected := map[time.Time]int{day(1): 2, day(2): 1, day(4): 1}
+	if len(histogram) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, histogram)
+	}
+	for bucket, n := range expected {
+		if histogram[bucket] != n {
+			t.Errorf("expected %d records in %v, got %d", n, bucket, histogram[bucket])
+		}
+	}
+
+	if _, err := db.Histogram(0); err == nil {
+		t.Errorf("expected error for a zero bucket")
+	}
+}
+
+func TestCaseCollisions(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file2|books|2023-07-01T00:00:00Z",
+		"/path/to/file3|BOOKS,Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	collisions, err := db.CaseCollisions()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(collisions) != 1 {
+		t.Fatalf("expected one collision, got %v", collisions)
+	}
+	if got := strings.Join(collisions["books"], ","); got != "BOOKS,Books,books" {
+		t.Errorf("expected BOOKS,Books,books, got %s", got)
+	}
+}
@@ -0,0 +1,275 @@
+package catobase
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressed reports whether the database is stored gzip-compressed, which
+// is the case when its path ends in ".gz".
+func (db *DB) compressed() bool {
+	return strings.HasSuffix(db.path, ".gz")
+}
+
+// gzipReadCloser closes both the decompressor and the file under it.
+type gzipReadCloser struct {
+	*gzip.Reader
+	file storageFile
+}
+
+func (r gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// openReader opens the database for reading, decompressing it if needed and
+// followed by any staged appends. A missing database yields os.ErrNotExist.
+func (db *DB) openReader() (io.ReadCloser, error) {
+	if db.opts.Append == AppendStaged {
+		return db.openStagedReader()
+	}
+	return db.openMain()
+}
+
+// openMain opens the database file itself for reading, decompressing it if
+// needed.
+func (db *DB) openMain() (io.ReadCloser, error) {
+	file, err := db.openFile(db.path, os.O_RDONLY, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	if !db.compressed() {
+		return file, nil
+	}
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			// An empty file is an empty database
+			return file, nil
+		}
+		file.Close()
+		return nil, err
+	}
+	return gzipReadCloser{Reader: zr, file: file}, nil
+}
+
+// ensureDir creates the directory of the database if Options.CreateDir is
+// set.
+func (db *DB) ensureDir() error {
+	if !db.opts.CreateDir {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return fmt.Errorf("failed to create database directory: %w", err)
+	}
+	return nil
+}
+
+// writeFile replaces the database with lines. They are written, compressed
+// when the database is, to a temporary file next to the database that is
+// then renamed over it, so readers see either the old or the new contents.
+func (db *DB) writeFile(lines []string) error {
+	return db.writeLines(func(emit func(line string)) error {
+		for _, line := range lines {
+			emit(line)
+		}
+		return nil
+	})
+}
+
+// writeLines is writeFile taking the lines from each, which passes them to
+// emit one at a time, so they need not all be held in memory. If each fails
+// the database is left as it was.
+func (db *DB) writeLines(each func(emit func(line string)) error) error {
+	if err := db.ensureDir(); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var out io.Writer = tmp
+	var zw *gzip.Writer
+	if db.compressed() {
+		zw = gzip.NewWriter(tmp)
+		out = zw
+	}
+	w := bufio.NewWriter(out)
+	sum := sha256.New()
+	err = each(func(line string) {
+		if isChecksumLine(line) {
+			return
+		}
+		w.WriteString(line + "\n")
+		sum.Write([]byte(line + "\n"))
+	})
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if db.opts.Checksum {
+		w.WriteString(checksumLine(sum.Sum(nil)) + "\n")
+	}
+	err = w.Flush()
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), db.path); err != nil {
+		return err
+	}
+	db.invalidate()
+	// The staged appends that were read are part of the new contents
+	db.removeClaimed()
+	return nil
+}
+
+// appendByRewrite appends lines to a compressed or checksummed database. A
+// gzip stream cannot be appended to in place, nor can a checksum footer be
+// updated, so the whole file is read back and rewritten, keeping every
+// existing line as it was.
+func (db *DB) appendByRewrite(sep string, lines []string) error {
+	var all []string
+	err := db.scanLines(func(l rawLine) error {
+		if !l.footer {
+			all = append(all, l.text)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(all) == 0 && db.opts.Header {
+		all = append(all, header{version: formatVersion, sep: sep}.String())
+	}
+	return db.writeFile(append(all, lines...))
+}
+
+// appender appends records to the database through a single open file, so
+// a run of appends opens the database once. A compressed or checksummed
+// database cannot be appended to; its lines are collected and rewritten by
+// close. Under AppendStaged they are collected too, and close stages them
+// as one file.
+type appender struct {
+	db      *DB
+	sep     string // the separator records must be written with
+	file    storageFile
+	w       *bufio.Writer
+	pending []string
+}
+
+// openAppender opens the database for appending, creating it, with a header
+// if one is wanted, when it is empty. The caller holds the write lock.
+func (db *DB) openAppender() (*appender, error) {
+	if db.compressed() || db.opts.Checksum || db.opts.Append == AppendStaged {
+		sep, err := db.separator()
+		if err != nil {
+			return nil, err
+		}
+		return &appender{db: db, sep: sep}, nil
+	}
+
+	if err := db.ensureDir(); err != nil {
+		return nil, err
+	}
+	f, err := db.openFile(db.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s for writing: %w", db.path, err)
+	}
+	a := &appender{db: db, sep: db.opts.Separator, file: f, w: bufio.NewWriter(f)}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		if db.opts.Header {
+			a.w.WriteString(header{version: formatVersion, sep: a.sep}.String() + "\n")
+		}
+		return a, nil
+	}
+
+	// Reads start at the beginning; O_APPEND only moves writes to the end
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	h, ok, err := parseHeader(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if ok {
+		a.sep = h.sep
+	}
+	return a, nil
+}
+
+// write appends lines, which are on disk once it returns, or once close does
+// when they are collected.
+func (a *appender) write(lines ...string) error {
+	if a.file == nil {
+		a.pending = append(a.pending, lines...)
+		return nil
+	}
+	for _, line := range lines {
+		a.w.WriteString(line + "\n")
+	}
+	if err := a.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", a.db.path, err)
+	}
+	a.db.invalidate()
+	return nil
+}
+
+// sync commits the appended lines to stable storage.
+func (a *appender) sync() error {
+	if a.file == nil {
+		return nil
+	}
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// close finishes the appends.
+func (a *appender) close() error {
+	if a.file == nil {
+		if len(a.pending) == 0 {
+			return nil
+		}
+		if a.db.opts.Append == AppendStaged {
+			return a.db.stage(a.pending)
+		}
+		return a.db.appendByRewrite(a.sep, a.pending)
+	}
+	err := a.w.Flush()
+	if cerr := a.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package catobase
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "file.txt")
+	setupTestFile(t, testFile, []string{"Books", "Movies"})
+	db, err := Open(filepath.Join(dir, ".catodb.gz"), &Options{Header: true})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := db.RegisterFile(testFile, []string{"Movies"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The file on disk is a valid gzip stream holding the header and records
+	f, err := os.Open(db.Path())
+	if err != nil {
+		t.Fatalf("failed to open db file: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("expected gzip data: %v", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress db: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 3 || lines[0] != "#catobase v1 sep=|" {
+		t.Errorf("expected header and 2 records, got %q", lines)
+	}
+
+	matches, err := db.Get("file", []string{"Movies"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != testFile {
+		t.Errorf("expected %s, got %v", testFile, matches)
+	}
+
+	// Rewrites stay compressed
+	if err := db.Canonicalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected 2 records after rewrite, got %v", records)
+	}
+}
+
+func TestCreateDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "nested", ".catodb")
+	testFile := filepath.Join(t.TempDir(), "file.txt")
+	setupTestFile(t, testFile, []string{"Books"})
+
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err == nil {
+		t.Errorf("expected error without CreateDir")
+	}
+
+	db, err = Open(path, &Options{CreateDir: true, Lock: true})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.RegisterFile(testFile, []string{"Books"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ok, err := db.IsRegistered(testFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Errorf("expected %s to be registered", testFile)
+	}
+}
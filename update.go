@@ -0,0 +1,521 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// SetCategories replaces the categories of every record for path with
+// categories, sorted and deduplicated, and stamps them with the current
+// time. It returns false if path is not registered.
+func (db *DB) SetCategories(path string, categories []string) (bool, error) {
+	sep, err := db.separator()
+	if err != nil {
+		return false, err
+	}
+	if err := validateCategories(categories, sep); err != nil {
+		return false, err
+	}
+
+	found := false
+	key := db.lookupKey(path)
+	err = db.update(func(records []Record) ([]Record, error) {
+		now := time.Now()
+		for i := range records {
+			if db.pathKey(records[i].Path) != key {
+				continue
+			}
+			records[i].Categories = NewCategorySet(db.normalize(categories)...).Slice()
+			records[i].Registered = now
+			found = true
+		}
+		if !found {
+			return nil, errUnchanged
+		}
+		return records, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// Prune removes the records registered before now minus olderThan and
+// returns how many were removed. Records with an unparseable timestamp are
+// kept unless Options.PruneUndated is set.
+func (db *DB) Prune(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	removed := 0
+	err := db.update(func(records []Record) ([]Record, error) {
+		kept := records[:0]
+		for _, r := range records {
+			if r.Registered.IsZero() {
+				if db.opts.PruneUndated {
+					removed++
+					continue
+				}
+			} else if r.Registered.Before(cutoff) {
+				removed++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if removed == 0 {
+			return nil, errUnchanged
+		}
+		if err := db.confirm(removed); err != nil {
+			removed = 0
+			return nil, err
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	db.logger().Debug("pruned records", "removed", removed)
+	return removed, nil
+}
+
+// SyncTimestampsFromMtime sets the timestamp of every record to the
+// modification time of its file, to the second, and returns how many records
+// changed. Records whose file no longer exists are left as they are. The
+// database is rewritten atomically.
+func (db *DB) SyncTimestampsFromMtime() (int, error) {
+	updated := 0
+	err := db.update(func(records []Record) ([]Record, error) {
+		for i, r := range records {
+			info, err := os.Stat(r.Path)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+			mtime := info.ModTime().Truncate(time.Second).UTC()
+			if r.Registered.Equal(mtime) {
+				continue
+			}
+			records[i].Registered = mtime
+			updated++
+		}
+		if updated == 0 {
+			return nil, errUnchanged
+		}
+		return records, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	db.logger().Debug("synced timestamps", "updated", updated)
+	return updated, nil
+}
+
+// UpsertPolicy decides how Upsert treats a path that is already registered.
+type UpsertPolicy int
+
+const (
+	// UpsertUnion adds the new categories to the existing ones. It is the
+	// zero value, so nothing is lost by default.
+	UpsertUnion UpsertPolicy = iota
+	// UpsertReplace swaps the existing categories for the new ones.
+	UpsertReplace
+	// UpsertKeep leaves an existing record untouched.
+	UpsertKeep
+)
+
+// Upsert registers path with categories, or updates its records according to
+// policy if it is already registered, stamping changed records with the
+// current time. It reports whether path was already registered. Unlike
+// RegisterFile it does not look at the file itself.
+func (db *DB) Upsert(path string, categories []string, policy UpsertPolicy) (bool, error) {
+	sep, err := db.separator()
+	if err != nil {
+		return false, err
+	}
+	stored, err := db.storedPathOf(path)
+	if err != nil {
+		return false, err
+	}
+	if err := validatePath(stored, sep); err != nil {
+		return false, err
+	}
+	if err := validateCategories(categories, sep); err != nil {
+		return false, err
+	}
+	path = db.resolvePath(stored)
+	categories = db.normalize(categories)
+
+	found := false
+	err = db.withWriteLock(func() error {
+		records, strays, err := db.recordsAndStrays()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		now := time.Now()
+		for i := range records {
+			if db.pathKey(records[i].Path) != db.pathKey(path) {
+				continue
+			}
+			found = true
+			switch policy {
+			case UpsertKeep:
+				continue
+			case UpsertReplace:
+				records[i].Categories = NewCategorySet(categories...).Slice()
+			default:
+				set := NewCategorySet(records[i].Categories...)
+				set.Add(categories...)
+				records[i].Categories = set.Slice()
+			}
+			records[i].Registered = now
+		}
+		if !found {
+			records = append(records, Record{Path: path, Categories: NewCategorySet(categories...).Slice(), Registered: now})
+		} else if policy == UpsertKeep {
+			return nil
+		}
+		return db.rewrite(records, strays)
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// ErrWouldRemoveAll is returned by UnregisterByPattern when the pattern
+// matches every record and removing them all was not allowed.
+var ErrWouldRemoveAll = errors.New("pattern matches every record")
+
+// UnregisterByPattern removes every record whose path matches regex and
+// returns how many were removed. As a guard against an overly broad pattern,
+// it refuses with ErrWouldRemoveAll to empty a non-empty database unless
+// allowAll is set; Clear is the direct way to do that.
+func (db *DB) UnregisterByPattern(regex string, allowAll bool) (int, error) {
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	err = db.update(func(records []Record) ([]Record, error) {
+		kept := records[:0]
+		for _, r := range records {
+			if re.MatchString(r.Path) {
+				removed++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if removed == 0 {
+			return nil, errUnchanged
+		}
+		if len(kept) == 0 && !allowAll {
+			removed = 0
+			return nil, ErrWouldRemoveAll
+		}
+		if err := db.confirm(removed); err != nil {
+			removed = 0
+			return nil, err
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	db.logger().Debug("unregistered records", "pattern", regex, "removed", removed)
+	return removed, nil
+}
+
+// TagMatching adds category to every record whose path matches regex and
+// that does not carry it yet, stamping them with the current time, and
+// returns how many were updated. The database is rewritten atomically.
+func (db *DB) TagMatching(regex string, category string) (int, error) {
+	return db.retagMatching(regex, category, "tagged records", func(set CategorySet, category string) bool {
+		if set.Has(category) {
+			return false
+		}
+		set.Add(category)
+		return true
+	})
+}
+
+// UntagMatching removes category from every record whose path matches regex,
+// stamping them with the current time, and returns how many were updated.
+// A record left without categories is kept, so its path stays registered;
+// remove such records with UnregisterByPattern. The database is rewritten
+// atomically.
+func (db *DB) UntagMatching(regex string, category string) (int, error) {
+	return db.retagMatching(regex, category, "untagged records", func(set CategorySet, category string) bool {
+		if !set.Has(category) {
+			return false
+		}
+		set.Remove(category)
+		return true
+	})
+}
+
+// retagMatching does the work of TagMatching and UntagMatching, applying
+// change to the categories of each matching record. change reports whether
+// it modified them.
+func (db *DB) retagMatching(regex string, category string, msg string, change func(set CategorySet, category string) bool) (int, error) {
+	sep, err := db.separator()
+	if err != nil {
+		return 0, err
+	}
+	if err := validateCategories([]string{category}, sep); err != nil {
+		return 0, err
+	}
+	re, err := db.compilePathPattern(regex)
+	if err != nil {
+		return 0, err
+	}
+	category = db.normalize([]string{category})[0]
+
+	updated := 0
+	err = db.update(func(records []Record) ([]Record, error) {
+		now := time.Now()
+		for i, r := range records {
+			if !re.MatchString(r.Path) {
+				continue
+			}
+			set := NewCategorySet(r.Categories...)
+			if !change(set, category) {
+				continue
+			}
+			records[i].Categories = set.Slice()
+			records[i].Registered = now
+			updated++
+		}
+		if updated == 0 {
+			return nil, errUnchanged
+		}
+		return records, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	db.logger().Debug(msg, "pattern", regex, "category", category, "updated", updated)
+	return updated, nil
+}
+
+// SplitCategory replaces old, in every record carrying it, with the
+// categories classify returns for that record, so "Media" can become "Video"
+// or "Audio" depending on the file. classify may return several categories,
+// or none to just drop old. Changed records are stamped with the current
+// time; the number of them is returned. The database is rewritten atomically,
+// and not at all if classify returns a category that cannot be stored.
+func (db *DB) SplitCategory(old string, classify func(rec Record) []string) (int, error) {
+	sep, err := db.separator()
+	if err != nil {
+		return 0, err
+	}
+	old = db.normalize([]string{old})[0]
+	changed := 0
+	err = db.update(func(records []Record) ([]Record, error) {
+		now := time.Now()
+		for i, r := range records {
+			set := NewCategorySet(r.Categories...)
+			if !set.Has(old) {
+				continue
+			}
+			replacements := classify(r)
+			if err := validateCategories(replacements, sep); err != nil {
+				return nil, fmt.Errorf("cannot split %s for %s: %w", old, r.Path, err)
+			}
+			before := set.Slice()
+			set.Remove(old)
+			set.Add(db.normalize(replacements)...)
+			categories := set.Slice()
+			if strings.Join(categories, ",") == strings.Join(before, ",") {
+				continue
+			}
+			records[i].Categories = categories
+			records[i].Registered = now
+			changed++
+		}
+		if changed == 0 {
+			return nil, errUnchanged
+		}
+		return records, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	db.logger().Debug("split category", "category", old, "changed", changed)
+	return changed, nil
+}
+
+// MergeCategories replaces, in every record, any of the sources with target,
+// so "film" and "movie" can become "Movie". A record carrying several sources
+// ends up with target once. Changed records are stamped with the current
+// time; the number of them is returned. The database is rewritten
+// atomically.
+func (db *DB) MergeCategories(sources []string, target string) (int, error) {
+	sep, err := db.separator()
+	if err != nil {
+		return 0, err
+	}
+	if err := validateCategories([]string{target}, sep); err != nil {
+		return 0, err
+	}
+	merge := NewCategorySet(db.normalize(sources)...)
+	target = db.normalize([]string{target})[0]
+	merge.Remove(target)
+
+	changed := 0
+	err = db.update(func(records []Record) ([]Record, error) {
+		now := time.Now()
+		for i, r := range records {
+			set := NewCategorySet(r.Categories...)
+			found := false
+			for c := range merge {
+				if set.Has(c) {
+					set.Remove(c)
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+			set.Add(target)
+			records[i].Categories = set.Slice()
+			records[i].Registered = now
+			changed++
+		}
+		if changed == 0 {
+			return nil, errUnchanged
+		}
+		return records, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	db.logger().Debug("merged categories", "sources", sources, "target", target, "changed", changed)
+	return changed, nil
+}
+
+// MergeDuplicates collapses the records of each path into one, at the
+// position of the first, carrying the union of their categories and the
+// newest timestamp. Metadata is merged, later records winning on a key. It
+// returns how many records were merged away.
+func (db *DB) MergeDuplicates() (int, error) {
+	merged := 0
+	err := db.update(func(records []Record) ([]Record, error) {
+		var kept []Record
+		var sets []CategorySet
+		index := make(map[string]int)
+		for _, r := range records {
+			key := db.pathKey(r.Path)
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(kept)
+				kept = append(kept, r)
+				sets = append(sets, NewCategorySet(r.Categories...))
+				continue
+			}
+			merged++
+			sets[i].Add(r.Categories...)
+			for k, v := range r.Meta {
+				if kept[i].Meta == nil {
+					kept[i].Meta = make(map[string]string)
+				}
+				kept[i].Meta[k] = v
+			}
+			if r.Registered.After(kept[i].Registered) {
+				kept[i].Registered = r.Registered
+			}
+		}
+		if merged == 0 {
+			return nil, errUnchanged
+		}
+		for i := range kept {
+			kept[i].Categories = sets[i].Slice()
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return merged, nil
+}
+
+// ErrAlreadyRegistered is returned when an operation would give a path a
+// record while it already has one.
+var ErrAlreadyRegistered = errors.New("path is already registered")
+
+// RelocateRecord moves the records of oldPath to newPath, for a file that was
+// moved without the database knowing. Nothing on disk besides the database is
+// touched. It returns false if oldPath is not registered, and
+// ErrAlreadyRegistered if newPath is.
+func (db *DB) RelocateRecord(oldPath, newPath string) (bool, error) {
+	sep, err := db.separator()
+	if err != nil {
+		return false, err
+	}
+	stored, err := db.storedPathOf(newPath)
+	if err != nil {
+		return false, err
+	}
+	if err := validatePath(stored, sep); err != nil {
+		return false, err
+	}
+	newPath = db.resolvePath(stored)
+
+	found := false
+	err = db.update(func(records []Record) ([]Record, error) {
+		for _, r := range records {
+			if db.pathKey(r.Path) == db.pathKey(newPath) {
+				return nil, fmt.Errorf("cannot relocate to %s: %w", newPath, ErrAlreadyRegistered)
+			}
+		}
+		for i := range records {
+			if db.pathKey(records[i].Path) == db.lookupKey(oldPath) {
+				records[i].Path = newPath
+				found = true
+			}
+		}
+		if !found {
+			return nil, errUnchanged
+		}
+		return records, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// ChangeSeparator rewrites the database with newSep separating the fields
+// of every record. The rewritten file always starts with a header naming
+// newSep, so any handle, this one included, reads it correctly afterwards.
+// Fields cannot be escaped, so it fails, leaving the database as it was, if
+// any path or category contains newSep. Separators that could not be read
+// back, such as whitespace or characters used in timestamps, are rejected.
+func (db *DB) ChangeSeparator(newSep string) error {
+	if err := validateSeparator(newSep); err != nil {
+		return err
+	}
+
+	return db.withWriteLock(func() error {
+		records, err := db.records()
+		if err != nil {
+			return err
+		}
+		lines := []string{header{version: formatVersion, sep: newSep}.String()}
+		for _, r := range records {
+			r.Path, _ = db.storedPath(r.Path)
+			if err := validateRecord(r, newSep); err != nil {
+				return err
+			}
+			lines = append(lines, formatRecord(r, newSep))
+		}
+		if err := db.writeFile(lines); err != nil {
+			return err
+		}
+		db.opts.Separator = newSep
+		return nil
+	})
+}
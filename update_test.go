@@ -0,0 +1,652 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetCategories(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	success, err := db.SetCategories("/path/to/file1", []string{"Games", "Comics"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !success {
+		t.Errorf("expected success, got failure")
+	}
+
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	got := strings.Join(records[0].Categories, ",")
+	if got != "Comics,Games" {
+		t.Errorf("expected categories Comics,Games, got %s", got)
+	}
+	if !records[0].Registered.After(records[1].Registered) {
+		t.Errorf("expected timestamp to be updated, got %v", records[0].Registered)
+	}
+	if strings.Join(records[1].Categories, ",") != "Music" {
+		t.Errorf("expected other records to be untouched, got %v", records[1].Categories)
+	}
+
+	// Test with an unregistered path
+	success, err = db.SetCategories("/path/to/missing", []string{"Games"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if success {
+		t.Errorf("expected failure, got success")
+	}
+
+	// Test with an invalid category
+	if _, err := db.SetCategories("/path/to/file1", []string{"a,b"}); err == nil {
+		t.Errorf("expected error for a category containing a comma")
+	}
+}
+
+func TestSetCategoriesKeepsMalformedLines(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/p/a|Books|2023-07-01T00:00:00Z",
+		"not a record",
+		"/p/b|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	if _, err := db.SetCategories("/p/a", []string{"Games"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 3 || lines[1] != "not a record" {
+		t.Errorf("expected the malformed line to be kept in place, got %v", lines)
+	}
+}
+
+func TestSetCategoriesHeaderSeparator(t *testing.T) {
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=#",
+		"/a#Books#2023-07-01T00:00:00Z",
+	}, nil)
+
+	if _, err := db.SetCategories("/a", []string{"x#y"}); err == nil {
+		t.Errorf("expected error for a category containing the header separator")
+	}
+	if matches, _ := db.Get(".*", []string{"Books"}); len(matches) != 1 {
+		t.Errorf("expected the record to be untouched, got %v", matches)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now().UTC()
+	recent := now.Add(-time.Hour).Format(time.RFC3339)
+	old := now.Add(-72 * time.Hour).Format(time.RFC3339)
+	lines := []string{
+		"/path/to/old1|Books|" + old,
+		"/path/to/new1|Books|" + recent,
+		"/path/to/old2|Music|" + old,
+		"/path/to/undated|Music|not-a-time",
+	}
+
+	db := openTestDB(t, lines, nil)
+	removed, err := db.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 records removed, got %d", removed)
+	}
+	matches, err := db.Get(".*", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(matches, " ") != "/path/to/new1 /path/to/undated" {
+		t.Errorf("expected the recent and undated records to remain, got %v", matches)
+	}
+	stored, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(stored) != 2 || stored[1] != lines[3] {
+		t.Errorf("expected the undated line to be kept as it was, got %v", stored)
+	}
+
+	// Undated records go too when asked
+	db = openTestDB(t, lines, &Options{PruneUndated: true})
+	removed, err = db.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("expected 3 records removed, got %d", removed)
+	}
+}
+
+func TestUpsertPolicies(t *testing.T) {
+	lines := []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}
+	cases := []struct {
+		name       string
+		policy     UpsertPolicy
+		categories []string
+		expected   string
+	}{
+		{"union overlapping", UpsertUnion, []string{"Movies", "Games"}, "Books,Games,Movies"},
+		{"union disjoint", UpsertUnion, []string{"Games"}, "Books,Games,Movies"},
+		{"replace overlapping", UpsertReplace, []string{"Movies", "Games"}, "Games,Movies"},
+		{"replace disjoint", UpsertReplace, []string{"Games"}, "Games"},
+		{"keep overlapping", UpsertKeep, []string{"Movies", "Games"}, "Books,Movies"},
+		{"keep disjoint", UpsertKeep, []string{"Games"}, "Books,Movies"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db := openTestDB(t, lines, nil)
+			existed, err := db.Upsert("/path/to/file1", c.categories, c.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !existed {
+				t.Errorf("expected the path to be reported as existing")
+			}
+			records, err := db.GetPaths([]string{"/path/to/file1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.Join(records[0].Categories, ","); got != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpsertInserts(t *testing.T) {
+	db := openTestDB(t, nil, nil)
+
+	existed, err := db.Upsert("/path/to/new", []string{"Books"}, UpsertUnion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if existed {
+		t.Errorf("expected a new path to be reported as inserted")
+	}
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(records) != 1 || records[0].Path != "/path/to/new" {
+		t.Errorf("expected the new record, got %v", records)
+	}
+}
+
+func TestUnregisterByPattern(t *testing.T) {
+	lines := []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/other/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|Games|2023-07-01T00:00:00Z",
+	}
+	db := openTestDB(t, lines, nil)
+
+	removed, err := db.UnregisterByPattern("^/path/", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 records removed, got %d", removed)
+	}
+	left, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(left) != 1 || left[0] != lines[1] {
+		t.Errorf("expected only %q to be left, got %v", lines[1], left)
+	}
+
+	removed, err = db.UnregisterByPattern("nomatch", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("expected nothing removed, got %d", removed)
+	}
+}
+
+func TestUnregisterByPatternAll(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	if _, err := db.UnregisterByPattern(".*", false); !errors.Is(err, ErrWouldRemoveAll) {
+		t.Fatalf("expected ErrWouldRemoveAll, got %v", err)
+	}
+	if lines, _ := readFile(db.Path()); len(lines) != 2 {
+		t.Errorf("expected the db to be untouched, got %v", lines)
+	}
+
+	removed, err := db.UnregisterByPattern(".*", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 records removed, got %d", removed)
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file1|Movies,Books|2023-07-03T00:00:00Z",
+		"/path/to/file1|Games|2023-07-02T00:00:00Z",
+	}, nil)
+
+	merged, err := db.MergeDuplicates()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if merged != 2 {
+		t.Errorf("expected 2 records merged away, got %d", merged)
+	}
+
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	expected := []string{
+		"/path/to/file1|Books,Games,Movies|2023-07-03T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
+
+func TestRelocateRecord(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.txt")
+	newPath := filepath.Join(dir, "new.txt")
+	setupTestFile(t, oldPath, []string{"Books"})
+	db := openTestDB(t, []string{
+		oldPath + "|Books|2023-07-01T00:00:00Z",
+		"/path/to/other|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	ok, err := db.RelocateRecord(oldPath, newPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected the record to be relocated")
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if lines[0] != newPath+"|Books|2023-07-01T00:00:00Z" {
+		t.Errorf("expected the path to be updated, got %q", lines[0])
+	}
+	if _, err := os.Stat(oldPath); err != nil {
+		t.Errorf("expected the file to stay where it was: %v", err)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("expected no file at the new path")
+	}
+
+	if ok, err := db.RelocateRecord(oldPath, "/path/to/elsewhere"); err != nil || ok {
+		t.Errorf("expected false for an unregistered path, got %v, %v", ok, err)
+	}
+	if _, err := db.RelocateRecord(newPath, "/path/to/other"); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+}
+
+func TestChangeSeparator(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|Books,Movies|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	if err := db.ChangeSeparator("#"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	expected := []string{
+		"#catobase v1 sep=#",
+		"/path/to/file1#Books,Movies#2023-07-01T00:00:00Z",
+		"/path/to/file2#Music#2023-07-01T00:00:00Z",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+
+	// Both this handle and a fresh one read the new separator
+	reopened, err := Open(db.Path(), nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	for _, d := range []*DB{db, reopened} {
+		matches, err := d.Get(".*", []string{"Books"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(matches) != 1 || matches[0] != "/path/to/file1" {
+			t.Errorf("expected [/path/to/file1], got %v", matches)
+		}
+	}
+
+	// A field containing the new separator cannot be rewritten
+	db = openTestDB(t, []string{"/path/with;semicolon|Books|2023-07-01T00:00:00Z"}, nil)
+	if err := db.ChangeSeparator(";"); err == nil {
+		t.Errorf("expected error for a path containing the new separator")
+	}
+	if lines, _ := readFile(db.Path()); len(lines) != 1 || !strings.Contains(lines[0], "|") {
+		t.Errorf("expected the db to be untouched, got %v", lines)
+	}
+
+	// Separators that could not be read back are refused
+	for _, sep := range []string{"", ",", "\n", " ", "\t", ":", "-", "T", "Z", "+", ".", "7"} {
+		if err := db.ChangeSeparator(sep); err == nil {
+			t.Errorf("expected error for separator %q", sep)
+		}
+	}
+	if lines, _ := readFile(db.Path()); len(lines) != 1 || lines[0] != "/path/with;semicolon|Books|2023-07-01T00:00:00Z" {
+		t.Errorf("expected the db to be untouched, got %v", lines)
+	}
+}
+
+func TestConfirmHook(t *testing.T) {
+	lines := []string{
+		"/path/to/file1|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3|Games|2023-07-01T00:00:00Z",
+	}
+	for _, answer := range []bool{false, true} {
+		var asked []int
+		opts := &Options{Confirm: func(affected int) bool {
+			asked = append(asked, affected)
+			return answer
+		}}
+
+		db := openTestDB(t, lines, opts)
+		removed, err := db.UnregisterByPattern("file[12]", false)
+		if answer && (err != nil || removed != 2) {
+			t.Errorf("expected 2 records removed, got %d, %v", removed, err)
+		}
+		if !answer && !errors.Is(err, ErrAborted) {
+			t.Errorf("expected ErrAborted, got %v", err)
+		}
+
+		db = openTestDB(t, lines, opts)
+		_, err = db.Prune(time.Hour)
+		if answer != (err == nil) {
+			t.Errorf("confirm %v: unexpected Prune result %v", answer, err)
+		}
+
+		db = openTestDB(t, lines, opts)
+		err = db.Clear()
+		if answer != (err == nil) {
+			t.Errorf("confirm %v: unexpected Clear result %v", answer, err)
+		}
+		left, _ := readFile(db.Path())
+		if answer == (len(left) != 0) {
+			t.Errorf("confirm %v: unexpected records left %v", answer, left)
+		}
+
+		if strings.Trim(fmt.Sprint(asked), "[]") != "2 3 3" {
+			t.Errorf("expected confirm to be asked with 2 3 3, got %v", asked)
+		}
+	}
+}
+
+func TestTagMatching(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1.txt|Books|2023-07-01T00:00:00Z",
+		"/path/to/file2.txt|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file3.pdf|Books|2023-07-01T00:00:00Z",
+	}, nil)
+
+	tagged, err := db.TagMatching(`\.txt$`, "Music")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tagged != 1 {
+		t.Errorf("expected 1 record tagged, got %d", tagged)
+	}
+
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	for i, prefix := range []string{
+		"/path/to/file1.txt|Books,Music|",
+		"/path/to/file2.txt|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file3.pdf|Books|2023-07-01T00:00:00Z",
+	} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected line %d to start with %q, got %q", i, prefix, lines[i])
+		}
+	}
+
+	tagged, err = db.TagMatching(`\.txt$`, "Music")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tagged != 0 {
+		t.Errorf("expected nothing left to tag, got %d", tagged)
+	}
+}
+
+func TestUntagMatching(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1.txt|Books,Music|2023-07-01T00:00:00Z",
+		"/path/to/file2.txt|Music|2023-07-01T00:00:00Z",
+		"/path/to/file3.txt|Books|2023-07-01T00:00:00Z",
+		"/path/to/file4.pdf|Music|2023-07-01T00:00:00Z",
+	}, nil)
+
+	untagged, err := db.UntagMatching(`\.txt$`, "Music")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if untagged != 2 {
+		t.Errorf("expected 2 records untagged, got %d", untagged)
+	}
+
+	matches, err := db.Get(".*", []string{"Music"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "/path/to/file4.pdf" {
+		t.Errorf("expected only /path/to/file4.pdf to keep Music, got %v", matches)
+	}
+
+	// A record left without categories stays registered
+	ok, err := db.IsRegistered("/path/to/file2.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Errorf("expected /path/to/file2.txt to stay registered")
+	}
+}
+
+func TestSyncTimestampsFromMtime(t *testing.T) {
+	dir := t.TempDir()
+	file1 := filepath.Join(dir, "file1.txt")
+	file2 := filepath.Join(dir, "file2.txt")
+	setupTestFile(t, file1, []string{"Books"})
+	setupTestFile(t, file2, []string{"Books"})
+	mtime1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mtime2 := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	os.Chtimes(file1, mtime1, mtime1)
+	os.Chtimes(file2, mtime2, mtime2)
+
+	db := openTestDB(t, []string{
+		file1 + "|Books|2023-07-01T00:00:00Z",
+		file2 + "|Books|",
+		"/path/to/missing|Books|2023-07-01T00:00:00Z",
+	}, nil)
+
+	updated, err := db.SyncTimestampsFromMtime()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("expected 2 records updated, got %d", updated)
+	}
+
+	records, err := db.GetPaths([]string{file1, file2, "/path/to/missing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %v", records)
+	}
+	expected := []time.Time{mtime1, mtime2, time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)}
+	for i, r := range records {
+		if !r.Registered.Equal(expected[i]) {
+			t.Errorf("expected %s registered at %v, got %v", r.Path, expected[i], r.Registered)
+		}
+	}
+}
+
+func TestSplitCategory(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/clip.mp4|Media,Books|2023-07-01T00:00:00Z",
+		"/path/to/song.mp3|Media|2023-07-01T00:00:00Z",
+		"/path/to/notes.txt|Books|2023-07-01T00:00:00Z",
+		"/path/to/film.mkv|Media|2023-07-01T00:00:00Z",
+	}, nil)
+
+	changed, err := db.SplitCategory("Media", func(r Record) []string {
+		switch filepath.Ext(r.Path) {
+		case ".mp4", ".mkv":
+			return []string{"Video"}
+		case ".mp3":
+			return []string{"Audio"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed != 3 {
+		t.Errorf("expected 3 records changed, got %d", changed)
+	}
+
+	records, err := db.latestRecords()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"Books,Video", "Audio", "Books", "Video"}
+	for i, r := range records {
+		if strings.Join(r.Categories, ",") != expected[i] {
+			t.Errorf("expected %s to carry %s, got %v", r.Path, expected[i], r.Categories)
+		}
+	}
+
+	// An unstorable category leaves the database untouched
+	if _, err := db.SplitCategory("Video", func(Record) []string { return []string{"a,b"} }); err == nil {
+		t.Errorf("expected error for an invalid category")
+	}
+	if matches, _ := db.Get(".*", []string{"Video"}); len(matches) != 2 {
+		t.Errorf("expected the Video records to be kept, got %v", matches)
+	}
+}
+
+func TestMergeCategories(t *testing.T) {
+	db := openTestDB(t, []string{
+		"/path/to/file1|film,Books|2023-07-01T00:00:00Z",
+		"/path/to/file2|film,movie|2023-07-01T00:00:00Z",
+		"/path/to/file3|Movie,movie|2023-07-01T00:00:00Z",
+		"/path/to/file4|Books|2023-07-01T00:00:00Z",
+		"/path/to/file5|Movie|2023-07-01T00:00:00Z",
+	}, nil)
+
+	changed, err := db.MergeCategories([]string{"film", "movie"}, "Movie")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed != 3 {
+		t.Errorf("expected 3 records changed, got %d", changed)
+	}
+
+	records, err := db.latestRecords()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"Books,Movie", "Movie", "Movie", "Books", "Movie"}
+	for i, r := range records {
+		if strings.Join(r.Categories, ",") != expected[i] {
+			t.Errorf("expected %s to carry %s, got %v", r.Path, expected[i], r.Categories)
+		}
+	}
+
+	if _, err := db.MergeCategories([]string{"Books"}, "a,b"); err == nil {
+		t.Errorf("expected error for an invalid target")
+	}
+}
+
+func TestTagMatchingHeaderSeparator(t *testing.T) {
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=#",
+		"/a#x#2023-07-01T00:00:00Z",
+	}, nil)
+
+	if _, err := db.TagMatching(".*", "p#q"); err == nil {
+		t.Errorf("expected error for a category containing the header separator")
+	}
+	if _, err := db.UntagMatching(".*", "p#q"); err == nil {
+		t.Errorf("expected error for a category containing the header separator")
+	}
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 2 || lines[1] != "/a#x#2023-07-01T00:00:00Z" {
+		t.Errorf("expected the db to be untouched, got %v", lines)
+	}
+}
+
+func TestSplitCategoryHeaderSeparator(t *testing.T) {
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=#",
+		"/a#Media#2023-07-01T00:00:00Z",
+	}, nil)
+
+	if _, err := db.SplitCategory("Media", func(Record) []string { return []string{"x#y"} }); err == nil {
+		t.Errorf("expected error for a category containing the header separator")
+	}
+	if matches, _ := db.Get(".*", []string{"Media"}); len(matches) != 1 {
+		t.Errorf("expected the record to be untouched, got %v", matches)
+	}
+}
+
+func TestMergeCategoriesHeaderSeparator(t *testing.T) {
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=#",
+		"/a#film#2023-07-01T00:00:00Z",
+	}, nil)
+
+	if _, err := db.MergeCategories([]string{"film"}, "x#y"); err == nil {
+		t.Errorf("expected error for a target containing the header separator")
+	}
+	if matches, _ := db.Get(".*", []string{"film"}); len(matches) != 1 {
+		t.Errorf("expected the record to be untouched, got %v", matches)
+	}
+}
@@ -0,0 +1,445 @@
+package catobase
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// WalkOptions controls how RegisterFolder and RegisterFiles walk a folder.
+type WalkOptions struct {
+	// Copy writes a copy of every registered file, as RegisterFile does.
+	// RegisterFiles always copies, whatever this says.
+	Copy bool
+
+	// FollowSymlinks descends into symlinked directories; symlinked files
+	// are always registered. Every directory is entered at most once, so
+	// symlink loops and links to already visited directories are skipped.
+	FollowSymlinks bool
+
+	// Incremental registers only files that have no record yet or whose
+	// modification time, to the second, is after their newest record.
+	Incremental bool
+
+	// Flat registers only the files directly inside folder. The folder is
+	// listed once with os.ReadDir rather than walked, which avoids visiting
+	// any descendant.
+	Flat bool
+
+	// SkipHidden skips files and directories whose names start with ".",
+	// such as .git, below folder. folder itself is walked even if hidden.
+	SkipHidden bool
+}
+
+// walker carries the state of a single RegisterFolder run.
+type walker struct {
+	db      *DB
+	root    string
+	re      *regexp.Regexp
+	ignore  *ignoreRules
+	opts    WalkOptions
+	visited []os.FileInfo
+	fn      func(path string) error
+	// open prepares the output on the first match, returning the separator
+	// records are formatted with; emit then writes each formatted record.
+	open   func() (string, error)
+	emit   func(line string) error
+	sep    string
+	opened bool
+	// known maps registered paths to their newest timestamp in incremental mode.
+	known map[string]time.Time
+}
+
+// RegisterFiles is RegisterFolder with WalkOptions.Copy forced on, so every
+// registered file is copied.
+//
+// Deprecated: the forced copies double the disk space of a folder. Use
+// RegisterFolder, which copies only when WalkOptions.Copy is set; callers
+// relying on the copies should set it explicitly.
+func (db *DB) RegisterFiles(folder string, regex string, opts *WalkOptions) ([]string, error) {
+	o := WalkOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.Copy = true
+	return db.RegisterFolder(folder, regex, &o)
+}
+
+// RegisterFolder scans folder and registers every file whose name matches
+// regex, using the file's lines as its categories. Paths matched by a
+// .catoignore file at the folder root are skipped. No copies are made unless
+// opts.Copy is set. A nil opts uses the defaults.
+func (db *DB) RegisterFolder(folder string, regex string, opts *WalkOptions) ([]string, error) {
+	var files []string
+	err := db.RegisterFolderFunc(folder, regex, opts, func(path string) error {
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// RegisterFolderFunc is RegisterFolder streaming its results: each record is
+// appended as soon as its file is found, and fn is called with the file's
+// path once the record is written. The write lock is held and the database
+// kept open for the whole walk, so fn must not write to the database. If fn
+// returns ErrStop the walk ends early and RegisterFolderFunc returns nil.
+// The walk is a bulk operation, see Options.BulkLock.
+func (db *DB) RegisterFolderFunc(folder string, regex string, opts *WalkOptions, fn func(path string) error) error {
+	w, walk, err := db.newWalker(folder, regex, opts, fn)
+	if err != nil {
+		return err
+	}
+	var app *appender
+	w.open = func() (string, error) {
+		var err error
+		if app, err = db.openAppender(); err != nil {
+			return "", err
+		}
+		return app.sep, nil
+	}
+	w.emit = func(line string) error {
+		return app.write(line)
+	}
+
+	return db.withBulkLock(func() error {
+		if w.opts.Incremental {
+			if w.known, err = db.registeredTimes(); err != nil {
+				return err
+			}
+		}
+		err := walk(folder)
+		if app != nil {
+			if cerr := app.close(); err == nil {
+				err = cerr
+			}
+		}
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		return err
+	})
+}
+
+// newWalker sets up a walk of folder for the files whose name matches
+// regex, returning the walker and the function that walks folder. The
+// caller sets the walker's output.
+func (db *DB) newWalker(folder string, regex string, opts *WalkOptions, fn func(path string) error) (*walker, func(dir string) error, error) {
+	re, err := compilePattern(regex)
+	if err != nil {
+		return nil, nil, err
+	}
+	ignore, err := loadIgnore(folder)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", ignoreFileName, err)
+	}
+
+	w := &walker{db: db, root: folder, re: re, ignore: ignore, fn: fn}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.FollowSymlinks {
+		info, err := os.Stat(folder)
+		if err != nil {
+			return nil, nil, err
+		}
+		w.seen(info)
+	}
+	if w.opts.Flat {
+		return w, w.listDir, nil
+	}
+	return w, w.walkDir, nil
+}
+
+// Rebuild replaces the database with a fresh registration of the files in
+// folder whose name matches regex, as RegisterFolder with default options
+// would add them, and returns the number of records written. The new
+// contents are written in one atomic rewrite once the walk has finished, so
+// a failed walk leaves the database as it was. Options.Confirm, if set, is
+// asked with the number of records being replaced. Rebuild is a bulk
+// operation, see Options.BulkLock.
+func (db *DB) Rebuild(folder string, regex string) (int, error) {
+	var lines []string
+	count := 0
+	w, walk, err := db.newWalker(folder, regex, nil, func(string) error { return nil })
+	if err != nil {
+		return 0, err
+	}
+	w.open = func() (string, error) {
+		_, _, sep, err := db.rewriteHeader()
+		return sep, err
+	}
+	w.emit = func(line string) error {
+		lines = append(lines, line)
+		count++
+		return nil
+	}
+
+	err = db.withBulkLock(func() error {
+		if err := walk(folder); err != nil {
+			return err
+		}
+		if db.opts.Confirm != nil {
+			records, err := db.records()
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if err := db.confirm(len(records)); err != nil {
+				return err
+			}
+		}
+		h, hasHeader, _, err := db.rewriteHeader()
+		if err != nil {
+			return err
+		}
+		if hasHeader {
+			lines = append([]string{h.String()}, lines...)
+		}
+		if err := db.writeFile(lines); err != nil {
+			return err
+		}
+		// Buffered registrations are replaced along with the file's
+		db.buffer = nil
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// listDir registers the matching files directly inside dir.
+func (w *walker) listDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range entries {
+		path := filepath.Join(dir, d.Name())
+		if d.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				continue
+			}
+		} else if d.IsDir() {
+			continue
+		}
+		if err := w.visit(path, d.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkDir walks the tree rooted at dir, which is folder itself or a
+// symlinked directory below it.
+func (w *walker) walkDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && d.Type()&fs.ModeSymlink != 0 && w.opts.FollowSymlinks {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if w.skipped(path, true) || w.seen(info) {
+					return nil
+				}
+				// A trailing separator makes WalkDir resolve the link
+				return w.walkDir(path + string(filepath.Separator))
+			}
+			return w.visit(path, info.Name())
+		}
+		if d.IsDir() {
+			if w.skipped(path, true) {
+				return filepath.SkipDir
+			}
+			if w.opts.FollowSymlinks && path != dir {
+				info, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				if w.seen(info) {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		return w.visit(path, d.Name())
+	})
+}
+
+// seen records the directory info and reports whether it was already visited.
+func (w *walker) seen(info os.FileInfo) bool {
+	for _, v := range w.visited {
+		if os.SameFile(v, info) {
+			return true
+		}
+	}
+	w.visited = append(w.visited, info)
+	return false
+}
+
+// skipped reports whether path is excluded by the folder's .catoignore, or
+// hidden when WalkOptions.SkipHidden is set.
+func (w *walker) skipped(path string, isDir bool) bool {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ignoreFileName || w.db.isOwnFile(path) {
+		return true
+	}
+	if w.opts.SkipHidden && strings.HasPrefix(filepath.Base(path), ".") {
+		return true
+	}
+	return w.ignore.match(rel, isDir)
+}
+
+// isOwnFile reports whether path is the database file or one it keeps
+// beside it: the lock, the staging directory and temporary files.
+func (db *DB) isOwnFile(path string) bool {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	if own, err := filepath.Abs(filepath.Dir(db.path)); err != nil || dir != own {
+		return false
+	}
+	name, base := filepath.Base(path), filepath.Base(db.path)
+	return name == base || name == filepath.Base(db.stagingDir()) ||
+		strings.HasPrefix(name, filepath.Base(db.lockPath())) || strings.HasPrefix(name, base+".tmp")
+}
+
+// visit registers the file at path if its name matches. Copies left beside
+// their originals by an earlier registration are never registered.
+func (w *walker) visit(path string, name string) error {
+	if w.skipped(path, false) || !w.re.MatchString(name) {
+		return nil
+	}
+	if w.db.opts.BackupRoot == "" && strings.HasSuffix(name, w.db.opts.CopySuffix) {
+		return nil
+	}
+	if registered, ok := w.known[w.db.lookupKey(path)]; ok {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Truncate(time.Second).After(registered) {
+			return nil
+		}
+	}
+	categories, err := readCategories(path)
+	if err != nil {
+		return err
+	}
+	if !w.opened {
+		if w.sep, err = w.open(); err != nil {
+			return err
+		}
+		w.opened = true
+	}
+	formatted, err := w.db.prepareRecord(path, categories, nil, w.opts.Copy, w.sep)
+	if err != nil {
+		return err
+	}
+	if err := w.emit(formatted); err != nil {
+		return err
+	}
+	w.db.logger().Debug("registered file", "path", path, "categories", categories, "copy", w.opts.Copy)
+	return w.fn(path)
+}
+
+// registeredTimes maps every registered path, by pathKey, to its newest timestamp.
+// A missing database has no registered paths.
+func (db *DB) registeredTimes() (map[string]time.Time, error) {
+	known := make(map[string]time.Time)
+	err := db.scan(func(r Record) error {
+		key := db.pathKey(r.Path)
+		if t, ok := known[key]; !ok || r.Registered.After(t) {
+			known[key] = r.Registered
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return known, nil
+}
+
+// FindOrphanCopies returns the copies under folder, files ending in
+// Options.CopySuffix, whose original no longer exists, so they can be
+// cleaned up. Copies kept under Options.BackupRoot are not looked at.
+func (db *DB) FindOrphanCopies(folder string) ([]string, error) {
+	var orphans []string
+	err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, db.opts.CopySuffix) {
+			return nil
+		}
+		original := strings.TrimSuffix(path, db.opts.CopySuffix)
+		if _, err := os.Lstat(original); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			orphans = append(orphans, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// FindDuplicateCategoryFiles walks folder and groups the files whose name
+// matches regex by the categories they list. Files listing the same set of
+// categories, whatever the order, repetitions, descriptions or blank lines,
+// end up together. Only groups of two or more files are returned, keyed by
+// their sorted categories joined with commas; each group is in walk order.
+func FindDuplicateCategoryFiles(folder, regex string) (map[string][]string, error) {
+	re, err := compilePattern(regex)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]string)
+	err = filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !re.MatchString(d.Name()) {
+			return nil
+		}
+		names, err := readCategories(path)
+		if err != nil {
+			return err
+		}
+		key := strings.Join(NewCategorySet(normalizeCategories(names)...).Slice(), ",")
+		groups[key] = append(groups[key], path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key, files := range groups {
+		if len(files) < 2 {
+			delete(groups, key)
+		}
+	}
+	return groups, nil
+}
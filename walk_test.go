@@ -0,0 +1,338 @@
+package catobase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterFilesFollowSymlinks(t *testing.T) {
+	base := t.TempDir()
+	folder := filepath.Join(base, "folder")
+	shared := filepath.Join(base, "shared")
+	os.MkdirAll(folder, 0755)
+	os.MkdirAll(shared, 0755)
+	setupTestFile(t, filepath.Join(folder, "file1.txt"), []string{"Books"})
+	setupTestFile(t, filepath.Join(shared, "file2.txt"), []string{"Music"})
+	if err := os.Symlink(shared, filepath.Join(folder, "linked")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	// A link back to the folder itself must not loop forever
+	if err := os.Symlink(folder, filepath.Join(folder, "loop")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	db := openTestDB(t, nil, nil)
+
+	// Symlinked directories are skipped by default
+	registered, err := db.RegisterFiles(folder, `\.txt$`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 1 {
+		t.Errorf("expected 1 registered file without following symlinks, got %v", registered)
+	}
+
+	registered, err = db.RegisterFiles(folder, `\.txt$`, &WalkOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(registered)
+	expected := []string{
+		filepath.Join(folder, "file1.txt"),
+		filepath.Join(folder, "linked", "file2.txt"),
+	}
+	if strings.Join(registered, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, registered)
+	}
+}
+
+func TestRegisterFilesIncremental(t *testing.T) {
+	folder := t.TempDir()
+	file1 := filepath.Join(folder, "file1.txt")
+	file2 := filepath.Join(folder, "file2.txt")
+	setupTestFile(t, file1, []string{"Books"})
+	setupTestFile(t, file2, []string{"Music"})
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(file1, past, past)
+	os.Chtimes(file2, past, past)
+
+	db := openTestDB(t, nil, nil)
+	opts := &WalkOptions{Incremental: true}
+
+	registered, err := db.RegisterFiles(folder, `\.txt$`, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 2 {
+		t.Fatalf("expected 2 registered files on the first run, got %v", registered)
+	}
+
+	// Only the file modified since its registration is picked up again
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(file2, future, future)
+	registered, err = db.RegisterFiles(folder, `\.txt$`, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 1 || registered[0] != file2 {
+		t.Errorf("expected only %s on the second run, got %v", file2, registered)
+	}
+
+	records, err := db.records()
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(records) != 3 {
+		t.Errorf("expected 3 records, got %d", len(records))
+	}
+}
+
+func TestRegisterFilesFlat(t *testing.T) {
+	folder := t.TempDir()
+	os.MkdirAll(filepath.Join(folder, "sub"), 0755)
+	setupTestFile(t, filepath.Join(folder, "file1.txt"), []string{"Books"})
+	setupTestFile(t, filepath.Join(folder, "sub", "file2.txt"), []string{"Music"})
+	db := openTestDB(t, nil, nil)
+
+	registered, err := db.RegisterFiles(folder, `\.txt$`, &WalkOptions{Flat: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 1 || registered[0] != filepath.Join(folder, "file1.txt") {
+		t.Errorf("expected only the top-level file, got %v", registered)
+	}
+}
+
+// benchmarkFlatFolder lists a large flat folder with a pattern that matches
+// nothing, so only the directory traversal is measured.
+func benchmarkFlatFolder(b *testing.B, opts *WalkOptions) {
+	folder := b.TempDir()
+	for i := 0; i < 2000; i++ {
+		f, err := os.Create(filepath.Join(folder, fmt.Sprintf("file%d.txt", i)))
+		if err != nil {
+			b.Fatalf("failed to create file: %v", err)
+		}
+		f.Close()
+	}
+	db, err := Open(filepath.Join(b.TempDir(), ".catodb"), nil)
+	if err != nil {
+		b.Fatalf("failed to open db: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.RegisterFiles(folder, `\.none$`, opts); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkRegisterFilesWalk(b *testing.B) {
+	benchmarkFlatFolder(b, nil)
+}
+
+func BenchmarkRegisterFilesFlat(b *testing.B) {
+	benchmarkFlatFolder(b, &WalkOptions{Flat: true})
+}
+
+func TestRegisterFolderDoesNotCopy(t *testing.T) {
+	folder := t.TempDir()
+	file := filepath.Join(folder, "file1.txt")
+	setupTestFile(t, file, []string{"Books"})
+
+	db := openTestDB(t, nil, nil)
+	registered, err := db.RegisterFolder(folder, `\.txt$`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 1 {
+		t.Errorf("expected 1 registered file, got %v", registered)
+	}
+	if _, err := os.Stat(file + ".copy"); !os.IsNotExist(err) {
+		t.Errorf("expected no copy by default")
+	}
+
+	if _, err := db.RegisterFolder(folder, `\.txt$`, &WalkOptions{Copy: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(file + ".copy"); err != nil {
+		t.Errorf("expected a copy when asked for one: %v", err)
+	}
+}
+
+func TestRegisterFolderFuncOpensDBOnce(t *testing.T) {
+	folder := t.TempDir()
+	for i := 1; i <= 3; i++ {
+		setupTestFile(t, filepath.Join(folder, fmt.Sprintf("file%d.txt", i)), []string{"Books"})
+	}
+
+	db := openTestDB(t, []string{"/path/to/old|Music|2023-07-01T00:00:00Z"}, nil)
+	opens := 0
+	db.openFile = func(name string, flag int, perm os.FileMode) (storageFile, error) {
+		if name == db.Path() {
+			opens++
+		}
+		return openOSFile(name, flag, perm)
+	}
+
+	var streamed []string
+	err := db.RegisterFolderFunc(folder, `\.txt$`, nil, func(path string) error {
+		streamed = append(streamed, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(streamed) != 3 {
+		t.Errorf("expected 3 files streamed, got %v", streamed)
+	}
+	if opens != 1 {
+		t.Errorf("expected the db to be opened once, got %d", opens)
+	}
+
+	db.openFile = openOSFile
+	for _, path := range streamed {
+		if ok, err := db.IsRegistered(path); err != nil || !ok {
+			t.Errorf("expected %s to be registered: %v", path, err)
+		}
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	folder := t.TempDir()
+	os.MkdirAll(filepath.Join(folder, "sub"), 0755)
+	setupTestFile(t, filepath.Join(folder, "file1.txt"), []string{"Books"})
+	setupTestFile(t, filepath.Join(folder, "sub", "file2.txt"), []string{"Music", "Games"})
+	setupTestFile(t, filepath.Join(folder, "notes.md"), []string{"Zines"})
+
+	db := openTestDB(t, []string{
+		"#catobase v1 sep=#",
+		"/path/to/stale#Movies#2023-07-01T00:00:00Z",
+	}, nil)
+
+	n, err := db.Rebuild(folder, `\.txt$`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 records, got %d", n)
+	}
+
+	lines, err := readFile(db.Path())
+	if err != nil {
+		t.Fatalf("failed to read db: %v", err)
+	}
+	if len(lines) != 3 || lines[0] != "#catobase v1 sep=#" {
+		t.Fatalf("expected the header and 2 records, got %v", lines)
+	}
+	matches, err := db.Get(".*", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(matches)
+	expected := []string{filepath.Join(folder, "file1.txt"), filepath.Join(folder, "sub", "file2.txt")}
+	if strings.Join(matches, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, matches)
+	}
+
+	// A walk that fails leaves the database alone
+	if _, err := db.Rebuild(filepath.Join(folder, "missing"), `.*`); err == nil {
+		t.Errorf("expected error for a missing folder")
+	}
+	if after, _ := readFile(db.Path()); len(after) != 3 {
+		t.Errorf("expected the database to be untouched, got %v", after)
+	}
+}
+
+func TestFindOrphanCopies(t *testing.T) {
+	folder := t.TempDir()
+	kept := filepath.Join(folder, "kept.txt")
+	removed := filepath.Join(folder, "sub", "removed.txt")
+	os.MkdirAll(filepath.Dir(removed), 0755)
+	for _, file := range []string{kept, kept + ".bak", removed + ".bak", filepath.Join(folder, "other.copy")} {
+		setupTestFile(t, file, []string{"Books"})
+	}
+
+	db := openTestDB(t, nil, &Options{CopySuffix: ".bak"})
+	orphans, err := db.FindOrphanCopies(folder)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(orphans) != 1 || orphans[0] != removed+".bak" {
+		t.Errorf("expected [%s], got %v", removed+".bak", orphans)
+	}
+}
+
+func TestRegisterFolderSkipHidden(t *testing.T) {
+	folder := filepath.Join(t.TempDir(), ".hidden-root")
+	os.MkdirAll(filepath.Join(folder, ".git", "objects"), 0755)
+	os.MkdirAll(filepath.Join(folder, "docs"), 0755)
+	for _, file := range []string{
+		filepath.Join(folder, ".git", "objects", "a.txt"),
+		filepath.Join(folder, ".notes.txt"),
+		filepath.Join(folder, "docs", "b.txt"),
+	} {
+		setupTestFile(t, file, []string{"Books"})
+	}
+
+	db := openTestDB(t, nil, nil)
+	registered, err := db.RegisterFolder(folder, `\.txt$`, &WalkOptions{SkipHidden: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 1 || registered[0] != filepath.Join(folder, "docs", "b.txt") {
+		t.Errorf("expected only docs/b.txt, got %v", registered)
+	}
+
+	registered, err = db.RegisterFolder(folder, `\.txt$`, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(registered) != 3 {
+		t.Errorf("expected hidden files to be registered by default, got %v", registered)
+	}
+}
+
+func TestRegisterFolderSkipsOwnFiles(t *testing.T) {
+	folder := t.TempDir()
+	setupTestFile(t, filepath.Join(folder, "a.txt"), []string{"Books"})
+	db, err := Open(filepath.Join(folder, "files.catodb"), &Options{Lock: true})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	setupTestFile(t, db.path+".tmp123", []string{"Books"})
+
+	for run := 1; run <= 2; run++ {
+		registered, err := db.RegisterFolder(folder, `.*`, nil)
+		if err != nil {
+			t.Fatalf("run %d: unexpected error: %v", run, err)
+		}
+		if len(registered) != 1 || registered[0] != filepath.Join(folder, "a.txt") {
+			t.Errorf("run %d: expected only a.txt, got %v", run, registered)
+		}
+	}
+}
+
+func TestFindDuplicateCategoryFiles(t *testing.T) {
+	folder := t.TempDir()
+	os.MkdirAll(filepath.Join(folder, "sub"), 0755)
+	a := filepath.Join(folder, "a.txt")
+	b := filepath.Join(folder, "sub", "b.txt")
+	setupTestFile(t, a, []string{"Books", "Music: songs"})
+	setupTestFile(t, b, []string{"Music", "", "Books", "Books"})
+	setupTestFile(t, filepath.Join(folder, "c.txt"), []string{"Books"})
+	setupTestFile(t, filepath.Join(folder, "d.md"), []string{"Books", "Music"})
+
+	groups, err := FindDuplicateCategoryFiles(folder, `\.txt$`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(groups) != 1 || strings.Join(groups["Books,Music"], " ") != a+" "+b {
+		t.Errorf("expected a.txt and sub/b.txt grouped under Books,Music, got %v", groups)
+	}
+}
@@ -0,0 +1,79 @@
+package catobase
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long WatchDB waits after a change before reporting
+// it, so a burst of writes is reported once.
+const watchDebounce = 50 * time.Millisecond
+
+// WatchDB calls onChange whenever the database file is written, replaced or
+// removed, by this process or any other, so a long-running process can
+// reload what it caches. Changes are reported shortly after the first one,
+// together with any that follow in the meantime, so a burst of writes
+// results in few calls even if it never pauses. Snapshots of the database
+// are invalidated before onChange runs. The directory holding the database
+// is watched, which keeps working across the atomic renames that rewrites
+// use.
+//
+// WatchDB blocks until ctx is done and then returns nil. It returns an error
+// if the watch cannot be set up or fails.
+func (db *DB) WatchDB(ctx context.Context, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dir := filepath.Dir(db.path)
+	if err := watcher.Add(dir); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, filepath.Base(db.path))
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != name || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) {
+				continue
+			}
+			if fire != nil {
+				// Already waiting to report an earlier change
+				continue
+			}
+			if timer == nil {
+				timer = time.NewTimer(watchDebounce)
+			} else {
+				timer.Reset(watchDebounce)
+			}
+			fire = timer.C
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-fire:
+			fire = nil
+			db.logger().Debug("database changed", "db", db.path)
+			db.invalidate()
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package catobase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchDB(t *testing.T) {
+	db := openTestDB(t, []string{"/path/to/file1|Books|2023-07-01T00:00:00Z"}, nil)
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := make(chan struct{}, 1)
+	var calls atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- db.WatchDB(ctx, func() {
+			calls.Add(1)
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	// Another process appends to the database; keep writing until the
+	// watch, which starts asynchronously, notices
+	other := filepath.Join(filepath.Dir(db.Path()), "other.txt")
+	setupTestFile(t, other, []string{"Books"})
+	otherDB, err := Open(db.Path(), nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	deadline := time.After(5 * time.Second)
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-changed:
+			break wait
+		case <-ticker.C:
+			if _, err := otherDB.RegisterFile(other, []string{"Books"}, false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-deadline:
+			t.Fatalf("expected onChange to fire")
+		}
+	}
+	if snapshot.Valid() {
+		t.Errorf("expected the snapshot to be invalidated")
+	}
+
+	// Unrelated files in the directory are not reported
+	ticker.Stop()
+	time.Sleep(2 * watchDebounce)
+	before := calls.Load()
+	os.WriteFile(filepath.Join(filepath.Dir(db.Path()), "unrelated.txt"), []byte("x\n"), 0644)
+	time.Sleep(4 * watchDebounce)
+	if after := calls.Load(); after != before {
+		t.Errorf("expected no call for an unrelated file, got %d more", after-before)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected WatchDB to return once ctx is done")
+	}
+}